@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+type mergeMembersInput struct {
+	SourceId string `json:"source_id" binding:"required"`
+	TargetId string `json:"target_id" binding:"required"`
+}
+
+type reassignSubmissionInput struct {
+	RoundId      string `json:"round_id" binding:"required"`
+	FromMemberId string `json:"from_member_id" binding:"required"`
+	ToMemberId   string `json:"to_member_id" binding:"required"`
+}
+
+type renameRoundInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// addAdminRoutes adds the data correction endpoints. Each correction is
+// recorded in the audit log and responds with its audit entry. They need an
+// API key with the admin scope.
+func addAdminRoutes(group *gin.RouterGroup) {
+	admin := group.Group("admin", requireScope(models.ScopeAdmin))
+	{
+		admin.POST("members/merge", mergeMembers)
+		admin.POST("submissions/reassign", reassignSubmission)
+		admin.POST("rounds/:round_id/rename", renameRound)
+		admin.DELETE("tracks/:track_id", deleteTrack)
+		admin.GET("audit", getAuditLog)
+	}
+}
+
+func mergeMembers(c *gin.Context) {
+	var input mergeMembersInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	entry, err := models.MergeMembers(c.Request.Context(), actor(c), input.SourceId, input.TargetId)
+	if writeFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, entry)
+}
+
+func reassignSubmission(c *gin.Context) {
+	var input reassignSubmissionInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	entry, err := models.ReassignSubmission(c.Request.Context(), actor(c), input.RoundId, input.FromMemberId, input.ToMemberId)
+	if writeFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, entry)
+}
+
+func renameRound(c *gin.Context) {
+	var input renameRoundInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	entry, err := models.RenameRound(c.Request.Context(), actor(c), c.Param("round_id"), input.Name)
+	if writeFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, entry)
+}
+
+func deleteTrack(c *gin.Context) {
+	entry, err := models.DeleteTrack(c.Request.Context(), actor(c), c.Param("track_id"), c.Query("replace_with"))
+	if writeFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, entry)
+}
+
+func getAuditLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "limit must be a number between 1 and 500"))
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "offset must be a positive number"))
+		return
+	}
+
+	entries, err := models.GetAuditLog(c.Request.Context(), models.AuditFilter{
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if queryFailed(c, err) {
+		return
+	}
+
+	if len(entries) == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// API keys can be sent as "Authorization: Bearer <key>" or in this header.
+const apiKeyHeader = "X-API-Key"
+
+// authenticate identifies the API key a request was made with, if any.
+// Requests without a key are still served, but can only read public leagues.
+// The shared admin token acts as a key with the admin scope. Keys that don't
+// exist are rate limited by limiter, unless it's nil.
+func authenticate(token string, limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := credential(c)
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		if token != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(token)) == 1 {
+			c.Set("key", models.APIKey{Id: "admin", Name: "admin", Scopes: []string{models.ScopeAdmin}, AllLeagues: true})
+			c.Set("actor", "admin")
+
+			c.Next()
+			return
+		}
+
+		guesses := "invalid-key:" + c.ClientIP()
+		if limiter != nil {
+			if wait := limiter.wait(guesses, limiter.now()); wait > 0 {
+				tooManyRequests(c, wait)
+				return
+			}
+		}
+
+		key, err := models.AuthenticateAPIKey(c.Request.Context(), secret)
+		if errors.Is(err, models.ErrNotFound) {
+			if limiter != nil {
+				limiter.take(guesses, 1, limiter.now())
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errorBody(c, "invalid API key"))
+			return
+		}
+		if queryFailed(c, err) {
+			return
+		}
+
+		c.Set("key", key)
+		c.Set("actor", "key:"+key.Name)
+
+		c.Next()
+	}
+}
+
+// requireScope only lets through requests made with a key that has the scope.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := callerKey(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errorBody(c, "an API key is required"))
+			return
+		}
+		if !key.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, errorBody(c, "this API key doesn't have the "+scope+" scope"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireLeague checks that the caller can use the league named in the
+// route, either directly or through one of its rounds.
+func requireLeague() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		leagueId := c.Param("league_id")
+		if leagueId == "" {
+			var err error
+			leagueId, err = models.GetRoundLeagueId(c.Request.Context(), c.Param("round_id"))
+			if queryFailed(c, err) {
+				return
+			}
+		}
+
+		if leagueAllowed(c, leagueId) {
+			c.Next()
+		}
+	}
+}
+
+// requireAllLeagues guards routes that cover every league, like member
+// careers and search.
+func requireAllLeagues() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if allLeaguesAllowed(c) {
+			c.Next()
+		}
+	}
+}
+
+// requireSearchLeague checks the league or round a comment search is
+// limited to, or every league if it isn't.
+func requireSearchLeague() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var allowed bool
+
+		switch {
+		case c.Query("league_id") != "":
+			allowed = leagueAllowed(c, c.Query("league_id"))
+		case c.Query("round_id") != "":
+			leagueId, err := models.GetRoundLeagueId(c.Request.Context(), c.Query("round_id"))
+			allowed = !queryFailed(c, err) && leagueAllowed(c, leagueId)
+		default:
+			allowed = allLeaguesAllowed(c)
+		}
+
+		if allowed {
+			c.Next()
+		}
+	}
+}
+
+// leagueAllowed reports whether the caller can use a league, responding
+// with an error if not. Anyone can read a public league, but private ones
+// answer as though they don't exist. Leagues that really don't exist are
+// left for the handler to report.
+func leagueAllowed(c *gin.Context, leagueId string) bool {
+	if leagueId == "" {
+		return true
+	}
+	if key, ok := callerKey(c); ok && key.CanAccess(leagueId) {
+		return true
+	}
+
+	private, err := models.IsLeaguePrivate(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return false
+	}
+
+	switch {
+	case private:
+		c.AbortWithStatusJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return false
+	case c.Request.Method != http.MethodGet:
+		c.AbortWithStatusJSON(http.StatusForbidden, errorBody(c, "this API key can't use league "+leagueId))
+		return false
+	}
+
+	return true
+}
+
+// allLeaguesAllowed reports whether the caller can use every league,
+// responding with an error if not. Reads are open to everyone as long as
+// no league is private.
+func allLeaguesAllowed(c *gin.Context) bool {
+	key, ok := callerKey(c)
+	if ok && key.AllLeagues {
+		return true
+	}
+
+	if c.Request.Method == http.MethodGet {
+		private, err := models.HasPrivateLeagues(c.Request.Context())
+		if queryFailed(c, err) {
+			return false
+		}
+
+		if !private {
+			return true
+		}
+	}
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, errorBody(c, "an API key that can use every league is required"))
+	} else {
+		c.AbortWithStatusJSON(http.StatusForbidden, errorBody(c, "this API key is limited to some leagues, and this covers all of them"))
+	}
+
+	return false
+}
+
+// callerKey returns the API key a request was made with.
+func callerKey(c *gin.Context) (models.APIKey, bool) {
+	value, ok := c.Get("key")
+	if !ok {
+		return models.APIKey{}, false
+	}
+
+	return value.(models.APIKey), true
+}
+
+// credential returns the API key sent with a request, if there is one.
+func credential(c *gin.Context) string {
+	if secret := c.GetHeader(apiKeyHeader); secret != "" {
+		return secret
+	}
+
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return ""
+}
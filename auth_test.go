@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// The tables an import creates, which the migrations build on.
+var importSchema = []string{
+	`CREATE TABLE results(league_id, round_id, voter_id, recipient_id, votes, track_id, comment, PRIMARY KEY (league_id, round_id, voter_id, recipient_id))`,
+	`CREATE TABLE members(id, name, picture, PRIMARY KEY (id))`,
+	`CREATE TABLE rounds(id, name, sequence, PRIMARY KEY (id))`,
+	`CREATE TABLE leagues(id, name, PRIMARY KEY (id))`,
+	`CREATE TABLE track_names(id, name, picture, PRIMARY KEY (id))`,
+	`CREATE TABLE submissions(league_id, round_id, submitter_id, track_id, comment, PRIMARY KEY (league_id, round_id, submitter_id, track_id))`,
+	`CREATE TABLE artist(id, name, popularity INTEGER, followers INTEGER, PRIMARY KEY (id))`,
+	`CREATE TABLE image(url, width INTEGER, height INTEGER, PRIMARY KEY (url))`,
+	`CREATE TABLE artist_images(artist_id, image_id, PRIMARY KEY (artist_id, image_id))`,
+	`CREATE TABLE artist_genres(artist_id, genre, PRIMARY KEY (artist_id, genre))`,
+}
+
+// testDatabase connects to a new database with a public league "open" and a
+// private league "closed", each with one round.
+func testDatabase(t *testing.T) {
+	t.Helper()
+	if benchHandler != nil {
+		t.Skip("the benchmarks are using the database")
+	}
+
+	path := filepath.Join(t.TempDir(), "music_league.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range importSchema {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := models.DefaultDBConfig()
+	config.Path = path
+	ctx := context.Background()
+	if err := models.ConnectDatabase(config); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.DB.Close() })
+	if err := models.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.PrepareStatements(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range []string{
+		`INSERT INTO leagues(id, name, private) VALUES ('open', 'Open', 0), ('closed', 'Closed', 1)`,
+		`INSERT INTO rounds(id, name, sequence, league_id) VALUES ('open-round', 'Open', 1, 'open'), ('closed-round', 'Closed', 1, 'closed')`,
+	} {
+		if _, err := models.DB.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// authTest is a request made with an API key, or without one if key is nil.
+type authTest struct {
+	name   string
+	key    *models.APIKey
+	method string
+	path   string
+	want   int
+}
+
+// runAuthTests sends each request through guard, which answers 200 if it
+// lets the request through.
+func runAuthTests(t *testing.T, guard gin.HandlerFunc, routes []string, tests []authTest) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if test.key != nil {
+					c.Set("key", *test.key)
+				}
+			})
+			for _, route := range routes {
+				router.Handle(test.method, route, guard, func(c *gin.Context) { c.Status(http.StatusOK) })
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			if w.Code != test.want {
+				t.Errorf("%s %s answered %d, want %d: %s", test.method, test.path, w.Code, test.want, w.Body)
+			}
+		})
+	}
+}
+
+var (
+	allLeaguesKey = &models.APIKey{Scopes: []string{models.ScopeWrite}, AllLeagues: true}
+	closedKey     = &models.APIKey{Scopes: []string{models.ScopeWrite}, LeagueIds: []string{"closed"}}
+	otherKey      = &models.APIKey{Scopes: []string{models.ScopeWrite}, LeagueIds: []string{"other"}}
+)
+
+func TestRequireLeague(t *testing.T) {
+	testDatabase(t)
+
+	runAuthTests(t, requireLeague(), []string{"/leagues/:league_id", "/rounds/:round_id"}, []authTest{
+		{"public league without a key", nil, http.MethodGet, "/leagues/open", http.StatusOK},
+		{"private league without a key", nil, http.MethodGet, "/leagues/closed", http.StatusNotFound},
+		{"writing a public league without a key", nil, http.MethodPost, "/leagues/open", http.StatusForbidden},
+		{"unknown league", nil, http.MethodGet, "/leagues/missing", http.StatusOK},
+		{"private league with its key", closedKey, http.MethodGet, "/leagues/closed", http.StatusOK},
+		{"writing a private league with its key", closedKey, http.MethodPost, "/leagues/closed", http.StatusOK},
+		{"private league with another key", otherKey, http.MethodGet, "/leagues/closed", http.StatusNotFound},
+		{"writing a public league with another key", otherKey, http.MethodPost, "/leagues/open", http.StatusForbidden},
+		{"private league with an all leagues key", allLeaguesKey, http.MethodGet, "/leagues/closed", http.StatusOK},
+		{"public round without a key", nil, http.MethodGet, "/rounds/open-round", http.StatusOK},
+		{"private round without a key", nil, http.MethodGet, "/rounds/closed-round", http.StatusNotFound},
+		{"private round with its league's key", closedKey, http.MethodGet, "/rounds/closed-round", http.StatusOK},
+		{"private round with another key", otherKey, http.MethodPost, "/rounds/closed-round", http.StatusNotFound},
+		{"unknown round", nil, http.MethodGet, "/rounds/missing", http.StatusOK},
+	})
+}
+
+func TestRequireSearchLeague(t *testing.T) {
+	testDatabase(t)
+
+	runAuthTests(t, requireSearchLeague(), []string{"/search"}, []authTest{
+		{"public league without a key", nil, http.MethodGet, "/search?league_id=open", http.StatusOK},
+		{"private league without a key", nil, http.MethodGet, "/search?league_id=closed", http.StatusNotFound},
+		{"private league with its key", closedKey, http.MethodGet, "/search?league_id=closed", http.StatusOK},
+		{"private league with another key", otherKey, http.MethodGet, "/search?league_id=closed", http.StatusNotFound},
+		{"public round without a key", nil, http.MethodGet, "/search?round_id=open-round", http.StatusOK},
+		{"private round without a key", nil, http.MethodGet, "/search?round_id=closed-round", http.StatusNotFound},
+		{"private round with its league's key", closedKey, http.MethodGet, "/search?round_id=closed-round", http.StatusOK},
+		{"every league without a key", nil, http.MethodGet, "/search", http.StatusUnauthorized},
+		{"every league with a limited key", closedKey, http.MethodGet, "/search", http.StatusForbidden},
+		{"every league with an all leagues key", allLeaguesKey, http.MethodGet, "/search", http.StatusOK},
+	})
+}
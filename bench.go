@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+type benchResult struct {
+	path    string
+	status  int
+	latency time.Duration
+}
+
+// runBench measures how many requests the server answers per second with
+// many of them in flight at once:
+//
+//	bench [-c concurrency] [-n requests] [path...]
+//
+// Requests go straight to the router, skipping the network, with rate
+// limiting off. The paths are under /v1 and default to a mix of endpoints
+// for the first league. Set MLS_ADMIN_TOKEN to read private leagues.
+func runBench(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	concurrency := flags.Int("c", 16, "requests in flight at once")
+	requests := flags.Int("n", 2000, "requests to send")
+	checkErr(flags.Parse(args))
+
+	if *concurrency < 1 || *requests < 1 {
+		fmt.Fprintln(os.Stderr, "-c and -n must be at least 1")
+		os.Exit(2)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		var err error
+		paths, err = benchPaths(ctx)
+		checkErr(err)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "there are no leagues with rounds to benchmark; give some paths instead")
+		os.Exit(1)
+	}
+
+	router := benchRouter()
+	send := func(path string) benchResult {
+		start := time.Now()
+		status := benchRequest(router, path)
+		return benchResult{path: path, status: status, latency: time.Since(start)}
+	}
+
+	// Warm up the connection pool and the statements prepared on it.
+	for _, path := range paths {
+		send(path)
+	}
+
+	jobs := make(chan string)
+	results := make(chan benchResult, *requests)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				results <- send(path)
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i := 0; i < *requests; i++ {
+		jobs <- paths[i%len(paths)]
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(results)
+
+	byPath := make(map[string][]benchResult)
+	all := make([]benchResult, 0, *requests)
+	for result := range results {
+		byPath[result.path] = append(byPath[result.path], result)
+		all = append(all, result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "PATH\tREQUESTS\tFAILED\tP50\tP95\tP99\n")
+	for _, path := range paths {
+		if results, ok := byPath[path]; ok {
+			printBenchRow(w, path, results)
+			delete(byPath, path)
+		}
+	}
+	printBenchRow(w, "all", all)
+	checkErr(w.Flush())
+
+	stats := models.DB.Stats()
+	fmt.Printf("\n%d requests in %s with %d in flight: %.0f requests/s\n",
+		*requests, elapsed.Round(time.Millisecond), *concurrency, float64(*requests)/elapsed.Seconds())
+	fmt.Printf("connections: %d open, %d idle, waited for one %d times (%s in total), closed %d idle ones\n",
+		stats.OpenConnections, stats.Idle, stats.WaitCount, stats.WaitDuration.Round(time.Millisecond), stats.MaxIdleClosed)
+}
+
+func printBenchRow(w io.Writer, path string, results []benchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].latency < results[j].latency
+	})
+
+	failed := 0
+	for _, result := range results {
+		if result.status >= http.StatusInternalServerError {
+			failed++
+		}
+	}
+
+	percentile := func(p float64) time.Duration {
+		return results[int(p*float64(len(results)-1))].latency.Round(time.Microsecond)
+	}
+
+	fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", path, len(results), failed, percentile(0.5), percentile(0.95), percentile(0.99))
+}
+
+// benchRouter builds the router with rate limiting off and only errors
+// logged, since every request is logged at info level, which would bury the
+// results.
+func benchRouter() *gin.Engine {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+	loadLimits()
+	return newRouter(nil)
+}
+
+// benchRequest sends a GET for a path under /v1 straight to the router and
+// returns the status it answered with.
+func benchRequest(router http.Handler, path string) int {
+	req := httptest.NewRequest(http.MethodGet, "/v1/"+path, nil)
+	if token := adminToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// benchPaths picks a mix of cheap and expensive endpoints from the first
+// league that has rounds, or returns none if no league has any.
+func benchPaths(ctx context.Context) ([]string, error) {
+	leagues, err := models.GetLeagues(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, league := range leagues {
+		rounds, err := models.GetRounds(ctx, league.Id)
+		if err != nil {
+			return nil, err
+		}
+		members, err := models.GetMembers(ctx, league.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rounds) == 0 || len(members) == 0 {
+			continue
+		}
+
+		leaguePath := "leagues/" + league.Id
+		round := rounds[0].Id
+		member := members[0].Id
+
+		return []string{
+			"leagues",
+			leaguePath,
+			leaguePath + "/rounds",
+			leaguePath + "/members",
+			"rounds/" + round,
+			"rounds/" + round + "/rankings",
+			"submissions/" + round,
+			"voters/" + round,
+			"members/" + member,
+			leaguePath + "/members/" + member + "/round_standings",
+			leaguePath + "/similarity/" + member,
+		}, nil
+	}
+
+	return nil, nil
+}
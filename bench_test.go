@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The benchmarks read a copy of MLS_DB_PATH (default ./music_league.db), so
+// migrating it never touches the original, and skip if there isn't one:
+//
+//	go test -tags sqlite_fts5 -run '^$' -bench . -cpu 1,4,16
+var (
+	benchHandler   *gin.Engine
+	benchEndpoints []string
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	flag.Parse()
+	source := envOrDefault(dbPathEnv, "./music_league.db")
+	if flag.Lookup("test.bench").Value.String() == "" {
+		return m.Run()
+	}
+	if _, err := os.Stat(source); err != nil {
+		return m.Run()
+	}
+
+	dir, err := os.MkdirTemp("", "music-league-bench")
+	checkErr(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "music_league.db")
+	checkErr(copyFile(source, path))
+	checkErr(os.Setenv(dbPathEnv, path))
+
+	ctx := context.Background()
+	connectDatabase(ctx)
+	benchHandler = benchRouter()
+	benchEndpoints, err = benchPaths(ctx)
+	checkErr(err)
+
+	return m.Run()
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// BenchmarkEndpoints sends each endpoint benchPaths picks from every
+// goroutine at once, one sub-benchmark per endpoint.
+func BenchmarkEndpoints(b *testing.B) {
+	if len(benchEndpoints) == 0 {
+		b.Skip("there is no database with a league that has rounds")
+	}
+
+	for _, path := range benchEndpoints {
+		b.Run(path, func(b *testing.B) {
+			if status := benchRequest(benchHandler, path); status != http.StatusOK {
+				b.Fatalf("GET /v1/%s answered %d", path, status)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if status := benchRequest(benchHandler, path); status != http.StatusOK {
+						b.Errorf("GET /v1/%s answered %d", path, status)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMix sends the endpoints in turn from every goroutine at once, like
+// the bench command.
+func BenchmarkMix(b *testing.B) {
+	if len(benchEndpoints) == 0 {
+		b.Skip("there is no database with a league that has rounds")
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			path := benchEndpoints[i%len(benchEndpoints)]
+			if status := benchRequest(benchHandler, path); status != http.StatusOK {
+				b.Errorf("GET /v1/%s answered %d", path, status)
+				return
+			}
+		}
+	})
+}
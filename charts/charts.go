@@ -0,0 +1,277 @@
+// Package charts draws simple charts as standalone SVG images.
+//
+// Charts only depend on their inputs, and coordinates are rounded to a tenth
+// of a pixel, so the same data always draws the same bytes.
+package charts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	MinSize = 50
+	MaxSize = 4000
+)
+
+var ErrInvalidSize = fmt.Errorf("width and height must be between %d and %d", MinSize, MaxSize)
+var ErrUnknownTheme = errors.New("unknown theme")
+
+type Theme struct {
+	Background string
+	Foreground string
+	Muted      string
+	Grid       string
+	Palette    []string
+}
+
+var Themes = map[string]Theme{
+	"light": {
+		Background: "#ffffff",
+		Foreground: "#1f1a2e",
+		Muted:      "#6b6580",
+		Grid:       "#e4e0ec",
+		Palette:    []string{"#7e57c2", "#ec407a", "#26a69a", "#ffa726", "#42a5f5", "#8d6e63", "#66bb6a", "#ef5350", "#5c6bc0", "#ab47bc"},
+	},
+	"dark": {
+		Background: "#14101f",
+		Foreground: "#f3f0fa",
+		Muted:      "#a59cbc",
+		Grid:       "#2f2745",
+		Palette:    []string{"#b388ff", "#ff80ab", "#64ffda", "#ffd180", "#82b1ff", "#bcaaa4", "#b9f6ca", "#ff8a80", "#8c9eff", "#ea80fc"},
+	},
+}
+
+type Options struct {
+	Width  int
+	Height int
+	Theme  Theme
+}
+
+// NewOptions looks up a theme by name and checks the chart size.
+func NewOptions(width, height int, theme string) (Options, error) {
+	if width < MinSize || width > MaxSize || height < MinSize || height > MaxSize {
+		return Options{}, ErrInvalidSize
+	}
+
+	t, exists := Themes[theme]
+	if !exists {
+		return Options{}, ErrUnknownTheme
+	}
+
+	return Options{Width: width, Height: height, Theme: t}, nil
+}
+
+type Series struct {
+	Name   string
+	Values []float64
+}
+
+// Line draws one line per series over the labelled x positions, with each
+// line's name at its right-hand end.
+func Line(w io.Writer, opts Options, labels []string, series []Series) error {
+	c := newCanvas(opts)
+	left, top, right, bottom := 40.0, 16.0, float64(opts.Width)-120, float64(opts.Height)-28
+
+	high := 0.0
+	for _, s := range series {
+		for _, v := range s.Values {
+			high = math.Max(high, v)
+		}
+	}
+	step, high := niceScale(high)
+
+	x := func(i int) float64 {
+		if len(labels) < 2 {
+			return left
+		}
+		return left + (right-left)*float64(i)/float64(len(labels)-1)
+	}
+	y := func(v float64) float64 {
+		return bottom - (bottom-top)*v/high
+	}
+
+	for i := 0; i <= int(math.Round(high/step)); i++ {
+		v := step * float64(i)
+		c.line(left, y(v), right, y(v), opts.Theme.Grid, 1)
+		c.text(left-6, y(v)+4, "end", opts.Theme.Muted, 11, fmt.Sprint(v))
+	}
+	for i, label := range labels {
+		c.text(x(i), bottom+18, "middle", opts.Theme.Muted, 11, label)
+	}
+
+	for i, s := range series {
+		color := opts.Theme.Palette[i%len(opts.Theme.Palette)]
+
+		points := make([]string, len(s.Values))
+		for j, v := range s.Values {
+			points[j] = c.point(x(j), y(v))
+		}
+		c.printf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="2" stroke-linejoin="round"><title>%s</title></polyline>`,
+			strings.Join(points, " "), color, html.EscapeString(s.Name))
+
+		if n := len(s.Values); n > 0 {
+			c.text(x(n-1)+6, y(s.Values[n-1])+4, "start", color, 11, s.Name)
+		}
+	}
+
+	return c.writeTo(w)
+}
+
+// Sparkline draws a small line with no axes, marking the last value. When
+// invert is set lower values are drawn higher, as for placements where 1st
+// is best.
+func Sparkline(w io.Writer, opts Options, values []float64, invert bool) error {
+	c := newCanvas(opts)
+	pad := 4.0
+	width, height := float64(opts.Width)-2*pad, float64(opts.Height)-2*pad
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+
+	x := func(i int) float64 {
+		if len(values) < 2 {
+			return pad + width/2
+		}
+		return pad + width*float64(i)/float64(len(values)-1)
+	}
+	y := func(v float64) float64 {
+		if high == low {
+			return pad + height/2
+		}
+		ratio := (v - low) / (high - low)
+		if invert {
+			ratio = 1 - ratio
+		}
+		return pad + height*(1-ratio)
+	}
+
+	color := opts.Theme.Palette[0]
+	points := make([]string, len(values))
+	for i, v := range values {
+		points[i] = c.point(x(i), y(v))
+	}
+	c.printf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5" stroke-linejoin="round"/>`, strings.Join(points, " "), color)
+
+	if n := len(values); n > 0 {
+		c.printf(`<circle cx="%.1f" cy="%.1f" r="2.5" fill="%s"/>`, x(n-1), y(values[n-1]), color)
+	}
+
+	return c.writeTo(w)
+}
+
+// Heatmap draws a square grid of values between 0 and 1, with the labels
+// along the left and top edges.
+func Heatmap(w io.Writer, opts Options, labels []string, values [][]float64) error {
+	c := newCanvas(opts)
+	margin := 110.0
+	size := math.Min(float64(opts.Width), float64(opts.Height)) - margin - 8
+	cell := size / math.Max(1, float64(len(labels)))
+	color := opts.Theme.Palette[0]
+
+	for i, label := range labels {
+		center := margin + cell*(float64(i)+0.5)
+		c.text(margin-6, center+4, "end", opts.Theme.Foreground, 11, label)
+		c.printf(`<text x="%.1f" y="%.1f" text-anchor="start" fill="%s" font-size="11" transform="rotate(-90 %.1f %.1f)">%s</text>`,
+			center+4, margin-6, opts.Theme.Foreground, center+4, margin-6, html.EscapeString(label))
+	}
+
+	for i, row := range values {
+		for j, v := range row {
+			c.printf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" fill-opacity="%.2f"><title>%s / %s: %.2f</title></rect>`,
+				margin+cell*float64(j), margin+cell*float64(i), cell, cell, color, math.Max(0.04, math.Min(1, v)),
+				html.EscapeString(labels[i]), html.EscapeString(labels[j]), v)
+		}
+	}
+
+	return c.writeTo(w)
+}
+
+// Bar draws a horizontal bar for each labelled value, in the order given.
+func Bar(w io.Writer, opts Options, labels []string, values []float64) error {
+	c := newCanvas(opts)
+	left, top, right, bottom := 120.0, 8.0, float64(opts.Width)-40, float64(opts.Height)-8
+
+	high := 0.0
+	for _, v := range values {
+		high = math.Max(high, v)
+	}
+	if high == 0 {
+		high = 1
+	}
+
+	slot := (bottom - top) / math.Max(1, float64(len(values)))
+	for i, v := range values {
+		y := top + slot*float64(i)
+		width := (right - left) * math.Max(0, v) / high
+		color := opts.Theme.Palette[i%len(opts.Theme.Palette)]
+
+		c.text(left-6, y+slot/2+4, "end", opts.Theme.Foreground, 11, labels[i])
+		c.printf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" rx="2"/>`, left, y+slot*0.15, width, slot*0.7, color)
+		c.text(left+width+4, y+slot/2+4, "start", opts.Theme.Muted, 11, fmt.Sprint(v))
+	}
+
+	return c.writeTo(w)
+}
+
+// niceScale picks a round tick step for an axis running from 0 to high, and
+// returns it along with the top of the axis.
+func niceScale(high float64) (float64, float64) {
+	if high <= 0 {
+		return 1, 1
+	}
+
+	raw := high / 5
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude * 10
+	for _, factor := range []float64{1, 2, 5} {
+		if factor*magnitude >= raw {
+			step = factor * magnitude
+			break
+		}
+	}
+
+	return step, math.Ceil(high/step) * step
+}
+
+type canvas struct {
+	buf bytes.Buffer
+}
+
+func newCanvas(opts Options) *canvas {
+	c := &canvas{}
+	c.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`,
+		opts.Width, opts.Height, opts.Width, opts.Height)
+	c.printf(`<rect width="100%%" height="100%%" fill="%s"/>`, opts.Theme.Background)
+	return c
+}
+
+func (c *canvas) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&c.buf, format, args...)
+	c.buf.WriteByte('\n')
+}
+
+func (c *canvas) point(x, y float64) string {
+	return fmt.Sprintf("%.1f,%.1f", x, y)
+}
+
+func (c *canvas) line(x1, y1, x2, y2 float64, color string, width float64) {
+	c.printf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"/>`, x1, y1, x2, y2, color, width)
+}
+
+func (c *canvas) text(x, y float64, anchor string, color string, size int, text string) {
+	c.printf(`<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s" font-size="%d">%s</text>`, x, y, anchor, color, size, html.EscapeString(text))
+}
+
+func (c *canvas) writeTo(w io.Writer) error {
+	c.printf(`</svg>`)
+	_, err := c.buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+	"github.com/thePurpleMonkey/music-league-stats-server/site"
+)
+
+// runCommand runs one of the offline commands instead of starting the server.
+func runCommand(ctx context.Context, name string, args []string) {
+	switch name {
+	case "backtest":
+		runBacktest(ctx, args)
+	case "score-sentiment":
+		runScoreSentiment(ctx)
+	case "render":
+		runRender(ctx, args)
+	case "apikey":
+		runAPIKey(ctx, args)
+	case "bench":
+		runBench(ctx, args)
+	case "import":
+		runImport(ctx, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		fmt.Fprintln(os.Stderr, "usage: music-league-stats-server [backtest [league_id...] | score-sentiment | render [output_dir] | apikey create|list|revoke | import start|finish | bench [-c n] [-n n] [path...]]")
+		os.Exit(2)
+	}
+}
+
+// runBacktest replays the rounds of the given leagues, or every league if none
+// are given, and prints how well the predictions matched the actual results.
+func runBacktest(ctx context.Context, leagueIds []string) {
+	if len(leagueIds) == 0 {
+		leagues, err := models.GetLeagues(ctx)
+		checkErr(err)
+
+		for _, league := range leagues {
+			leagueIds = append(leagueIds, league.Id)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, leagueId := range leagueIds {
+		backtest, err := models.BacktestLeague(ctx, leagueId)
+		checkErr(err)
+
+		if backtest.League.Id == "" {
+			fmt.Fprintf(os.Stderr, "league %s not found\n", leagueId)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\n", backtest.League.Name)
+		fmt.Fprintf(w, "ROUND\tRANK CORRELATION\tTOP-3 HIT RATE\n")
+		for _, round := range backtest.Rounds {
+			fmt.Fprintf(w, "%s\t%.3f\t%.2f\n", round.Round.Name, round.RankCorrelation, round.Top3HitRate)
+		}
+		fmt.Fprintf(w, "MEAN\t%.3f\t%.2f\n\n", backtest.MeanRankCorrelation, backtest.MeanTop3HitRate)
+	}
+
+	checkErr(w.Flush())
+}
+
+// runScoreSentiment scores any vote comments added or changed since the last
+// run. The server does this on startup too; this is for after an import.
+func runScoreSentiment(ctx context.Context) {
+	scored, err := models.ScoreComments(ctx)
+	checkErr(err)
+
+	fmt.Printf("scored %d comments\n", scored)
+}
+
+// runRender writes a static archive of every league to the given directory,
+// or ./archive if none is given.
+func runRender(ctx context.Context, args []string) {
+	dir := "archive"
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	files, err := site.Render(ctx, dir)
+	checkErr(err)
+
+	fmt.Printf("wrote %d files to %s\n", files, dir)
+}
+
+// runImport is run by imports before and after they write to the database:
+//
+//	import start
+//	import finish
+//
+// The server reports that it isn't ready in between. Finishing also ends any
+// import that was started and never finished, say because it crashed.
+func runImport(ctx context.Context, args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "start":
+		checkErr(models.StartImport(ctx))
+		fmt.Println("import started")
+
+	case len(args) == 1 && args[0] == "finish":
+		err := models.FinishImport(ctx)
+		if errors.Is(err, models.ErrNotFound) {
+			fmt.Fprintln(os.Stderr, "no import was running")
+			os.Exit(1)
+		}
+		checkErr(err)
+
+		fmt.Println("import finished")
+
+	default:
+		fmt.Fprintln(os.Stderr, "usage: music-league-stats-server import [start | finish]")
+		os.Exit(2)
+	}
+}
+
+// runAPIKey manages API keys:
+//
+//	apikey create <name> <scope>[,<scope>...] [league_id...]
+//	apikey list
+//	apikey revoke <name>
+//
+// A key given league ids can only use those leagues.
+func runAPIKey(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+
+	switch {
+	case args[0] == "create" && len(args) >= 3:
+		key, secret, err := models.CreateAPIKey(ctx, args[1], strings.Split(args[2], ","), args[3:])
+		var validation models.ValidationError
+		if errors.As(err, &validation) || errors.Is(err, models.ErrConflict) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		checkErr(err)
+
+		fmt.Printf("created key %s with scopes %s\n", key.Name, strings.Join(key.Scopes, ", "))
+		fmt.Println("it won't be shown again:")
+		fmt.Println(secret)
+
+	case args[0] == "list" && len(args) == 1:
+		keys, err := models.GetAPIKeys(ctx)
+		checkErr(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "NAME\tPREFIX\tSCOPES\tLEAGUES\tCREATED\tREVOKED\n")
+		for _, key := range keys {
+			leagues := "all"
+			if !key.AllLeagues {
+				leagues = strings.Join(key.LeagueIds, ",")
+			}
+			if leagues == "" {
+				leagues = "none"
+			}
+			revoked := "-"
+			if key.RevokedAt != nil {
+				revoked = key.RevokedAt.Format("2006-01-02")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.Name, key.Prefix, strings.Join(key.Scopes, ","),
+				leagues, key.CreatedAt.Format("2006-01-02"), revoked)
+		}
+		checkErr(w.Flush())
+
+	case args[0] == "revoke" && len(args) == 2:
+		err := models.RevokeAPIKey(ctx, args[1])
+		if errors.Is(err, models.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "no active key named %s\n", args[1])
+			os.Exit(1)
+		}
+		checkErr(err)
+
+		fmt.Printf("revoked key %s\n", args[1])
+
+	default:
+		fmt.Fprintln(os.Stderr, "usage: music-league-stats-server apikey [create <name> <scope>[,<scope>...] [league_id...] | list | revoke <name>]")
+		fmt.Fprintln(os.Stderr, "scopes are "+strings.Join(models.Scopes, ", "))
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// Database settings, from the environment:
+//
+//	MLS_DB_PATH          the SQLite database (default ./music_league.db)
+//	MLS_DB_MAX_CONNS     how many connections can be open at once, or 0 for
+//	                     no limit (default 64)
+//	MLS_DB_MAX_IDLE      how many connections are kept open between requests
+//	                     (default 16)
+//	MLS_DB_BUSY_TIMEOUT  how long a write waits for another to finish
+//	                     (default 5s)
+const (
+	dbPathEnv        = "MLS_DB_PATH"
+	dbMaxConnsEnv    = "MLS_DB_MAX_CONNS"
+	dbMaxIdleEnv     = "MLS_DB_MAX_IDLE"
+	dbBusyTimeoutEnv = "MLS_DB_BUSY_TIMEOUT"
+)
+
+// connectDatabase opens the database, brings its schema up to date and
+// prepares the statements the models use.
+func connectDatabase(ctx context.Context) {
+	config := models.DefaultDBConfig()
+	config.Path = envOrDefault(dbPathEnv, config.Path)
+
+	var err error
+	config.MaxOpenConns, err = strconv.Atoi(envOrDefault(dbMaxConnsEnv, strconv.Itoa(config.MaxOpenConns)))
+	if err != nil || config.MaxOpenConns < 0 {
+		fatalf("%s must be a number of connections", dbMaxConnsEnv)
+	}
+	config.MaxIdleConns, err = strconv.Atoi(envOrDefault(dbMaxIdleEnv, strconv.Itoa(config.MaxIdleConns)))
+	if err != nil || config.MaxIdleConns < 0 {
+		fatalf("%s must be a number of connections", dbMaxIdleEnv)
+	}
+	config.BusyTimeout, err = time.ParseDuration(envOrDefault(dbBusyTimeoutEnv, config.BusyTimeout.String()))
+	if err != nil || config.BusyTimeout < 0 {
+		fatalf("%s must be a duration like 5s", dbBusyTimeoutEnv)
+	}
+
+	checkErr(models.ConnectDatabase(config))
+	checkErr(models.Migrate(ctx))
+	checkErr(models.PrepareStatements(ctx))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// readyTimeout bounds the checks behind /readyz, so a stuck database shows
+// up as not ready instead of a probe that never answers.
+const readyTimeout = 2 * time.Second
+
+// shuttingDown is set once the server has started shutting down, so load
+// balancers stop sending it requests while the last ones finish.
+var shuttingDown atomic.Bool
+
+// MLS_SHUTDOWN_DELAY is how long the server keeps taking requests after it's
+// told to stop, with /readyz failing, so load balancers notice before new
+// connections are refused (default 5s).
+const shutdownDelayEnv = "MLS_SHUTDOWN_DELAY"
+
+func shutdownDelay() time.Duration {
+	delay, err := time.ParseDuration(envOrDefault(shutdownDelayEnv, "5s"))
+	if err != nil || delay < 0 {
+		fatalf("%s must be a duration like 5s", shutdownDelayEnv)
+	}
+	return delay
+}
+
+// addHealthRoutes adds the probes used by whatever runs the server. They
+// sit outside /v1 so they're never rate limited or asked for a key.
+func addHealthRoutes(router *gin.Engine) {
+	router.GET("healthz", getHealth)
+	router.GET("readyz", getReady)
+}
+
+// getHealth answers as long as the process is running.
+func getHealth(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// getReady reports whether the server can answer requests: the database can
+// be reached, its schema is up to date and no import is writing to it.
+func getReady(c *gin.Context) {
+	if shuttingDown.Load() {
+		notReady(c, "shutting down")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	if err := models.Ping(ctx); err != nil {
+		databaseUnreachable(c, err)
+		return
+	}
+
+	pending, err := models.PendingMigrations(ctx)
+	if err != nil {
+		databaseUnreachable(c, err)
+		return
+	}
+	if len(pending) > 0 {
+		notReady(c, "migrations not applied: "+strings.Join(pending, ", "))
+		return
+	}
+
+	importing, err := models.ImportRunning(ctx)
+	if err != nil {
+		databaseUnreachable(c, err)
+		return
+	}
+	if importing {
+		notReady(c, "import in progress")
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// databaseUnreachable logs why the database couldn't be checked, which may
+// say more about the server than a probe should see.
+func databaseUnreachable(c *gin.Context, err error) {
+	slog.ErrorContext(c.Request.Context(), "readiness check failed", "error", err)
+	notReady(c, "database unreachable")
+}
+
+func notReady(c *gin.Context, reason string) {
+	c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "reason": reason})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on what each client can ask of the server, set from the
+// environment:
+//
+//	MLS_RATE_LIMIT       requests per second each client can make on average,
+//	                     or 0 for no limit (default 5)
+//	MLS_RATE_BURST       requests a client can make at once (default 60)
+//	MLS_QUERY_TIMEOUT    how long a request's queries can run (default 10s)
+//	MLS_TRUSTED_PROXIES  comma-separated proxies whose X-Forwarded-For is
+//	                     believed when telling clients apart (default none)
+//
+// Clients are told apart by API key, or by IP address if they don't send one.
+// Requests with a key that doesn't exist count against their IP address in
+// a bucket of their own, which is checked before the key is looked up, so
+// keys can't be guessed faster than the rate limit.
+const (
+	rateLimitEnv      = "MLS_RATE_LIMIT"
+	rateBurstEnv      = "MLS_RATE_BURST"
+	queryTimeoutEnv   = "MLS_QUERY_TIMEOUT"
+	trustedProxiesEnv = "MLS_TRUSTED_PROXIES"
+)
+
+// Request bodies are small JSON documents, so anything bigger is refused.
+const maxRequestBody = 1 << 20
+
+// routeCosts is how many requests' worth of a client's budget each expensive
+// route uses. Other routes cost 1.
+var routeCosts = map[string]float64{
+	"/v1/rounds/:round_id/similarity/:member_id":                      5,
+	"/v1/leagues/:league_id/similarity/:member_id":                    10,
+	"/v1/leagues/:league_id/charts/similarity.svg":                    10,
+	"/v1/leagues/:league_id/members/:member_id/round_standings":       5,
+	"/v1/leagues/:league_id/members/:member_id/charts/placements.svg": 5,
+	"/v1/leagues/:league_id/charts/standings.svg":                     5,
+	"/v1/leagues/:league_id/backtest":                                 10,
+	"/v1/leagues/:league_id/reciprocity":                              10,
+	"/v1/leagues/:league_id/wrapped":                                  10,
+	"/v1/leagues/:league_id/members/:member_id/wrapped":               10,
+	"/v1/rounds/:round_id/predictions":                                10,
+	"/v1/ratings":                                                     10,
+	"/v1/members/:member_id/ratings":                                  10,
+	"/v1/members/:member_id/career":                                   5,
+	"/v1/search":                                                      2,
+	"/v1/search/comments":                                             2,
+}
+
+var queryTimeout = 10 * time.Second
+
+// loadLimits reads the limits from the environment and returns the rate
+// limiter to use, which is nil if rate limiting is off.
+func loadLimits() *rateLimiter {
+	timeout, err := time.ParseDuration(envOrDefault(queryTimeoutEnv, "10s"))
+	if err != nil || timeout <= 0 {
+		fatalf("%s must be a positive duration like 10s", queryTimeoutEnv)
+	}
+	queryTimeout = timeout
+
+	rate, err := strconv.ParseFloat(envOrDefault(rateLimitEnv, "5"), 64)
+	if err != nil || rate < 0 {
+		fatalf("%s must be a number of requests per second", rateLimitEnv)
+	}
+	burst, err := strconv.ParseFloat(envOrDefault(rateBurstEnv, "60"), 64)
+	if err != nil || burst < 1 {
+		fatalf("%s must be a number of requests", rateBurstEnv)
+	}
+
+	return newRateLimiter(rate, burst)
+}
+
+func trustedProxies() []string {
+	if value := os.Getenv(trustedProxiesEnv); value != "" {
+		return strings.Split(value, ",")
+	}
+
+	return nil
+}
+
+// limitRequests refuses requests from clients that have used up their
+// budget, and caps the size of request bodies.
+func limitRequests(limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRequestBody)
+
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		client := "ip:" + c.ClientIP()
+		if key, ok := callerKey(c); ok {
+			client = "key:" + key.Id
+		}
+
+		cost, ok := routeCosts[c.FullPath()]
+		if !ok {
+			cost = 1
+		}
+
+		if allowed, wait := limiter.take(client, cost, limiter.now()); !allowed {
+			tooManyRequests(c, wait)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// tooManyRequests refuses a request from a client that has used up its
+// budget, telling it how long to wait.
+func tooManyRequests(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, errorBody(c, "too many requests; try again later"))
+}
+
+// limitQueryTime gives each request a deadline for its queries. The models
+// take the request's context, so they stop once it passes or the client goes
+// away.
+func limitQueryTime() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), queryTimeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// queryFailed responds to a query that failed and reports whether it did.
+// Queries cut short by the deadline or the client leaving are expected, and
+// are attached to the request for the metrics and logs; other errors are
+// logged with the request's ID and answered with a 500.
+func queryFailed(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		c.Error(err)
+		c.IndentedJSON(http.StatusServiceUnavailable, errorBody(c, "the query took too long"))
+	case errors.Is(err, context.Canceled):
+		// The client has gone, so there's no one to respond to.
+		c.Error(err)
+		c.Abort()
+	default:
+		slog.ErrorContext(c.Request.Context(), "query failed", "error", err)
+		c.IndentedJSON(http.StatusInternalServerError, errorBody(c, "the query failed"))
+	}
+
+	return true
+}
+
+// rateLimiter gives each client a token bucket that holds up to burst
+// tokens and refills at rate tokens per second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	// now is the clock the middleware reads, which tests replace.
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter returns a limiter, or nil if rate is 0 and there's no limit.
+func newRateLimiter(rate float64, burst float64) *rateLimiter {
+	if rate == 0 {
+		return nil
+	}
+
+	return &rateLimiter{rate: rate, burst: burst, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// take removes cost tokens from a client's bucket. If there aren't enough it
+// takes none, and returns how long until there will be.
+func (l *rateLimiter) take(client string, cost float64, now time.Time) (bool, time.Duration) {
+	// A route can't cost more than a full bucket, or it could never be used.
+	cost = math.Min(cost, l.burst)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(client, now)
+	if b.tokens < cost {
+		return false, time.Duration((cost - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens -= cost
+	return true, 0
+}
+
+// wait returns how long until a client's bucket holds a token, without
+// taking it.
+func (l *rateLimiter) wait(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(client, now)
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	return 0
+}
+
+// refill tops up a client's bucket for the time since it was last used. l.mu
+// must be held.
+func (l *rateLimiter) refill(client string, now time.Time) *bucket {
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	return b
+}
+
+// sweep forgets clients whose buckets have refilled, since a new bucket would
+// be the same. It runs at most once a minute.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.updated) >= full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+func envOrDefault(name string, value string) string {
+	if env := os.Getenv(name); env != "" {
+		return env
+	}
+
+	return value
+}
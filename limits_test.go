@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// clock is a time that tests move by hand.
+type clock struct{ time time.Time }
+
+func (c *clock) now() time.Time { return c.time }
+
+func (c *clock) advance(d time.Duration) { c.time = c.time.Add(d) }
+
+func TestRateLimiterRefill(t *testing.T) {
+	clock := &clock{time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(2, 4)
+
+	take := func(want bool, wantWait time.Duration) {
+		t.Helper()
+		allowed, wait := limiter.take("a", 1, clock.now())
+		if allowed != want || wait != wantWait {
+			t.Errorf("take = %v, %v; want %v, %v", allowed, wait, want, wantWait)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		take(true, 0)
+	}
+	take(false, 500*time.Millisecond)
+
+	clock.advance(250 * time.Millisecond)
+	take(false, 250*time.Millisecond)
+
+	clock.advance(250 * time.Millisecond)
+	take(true, 0)
+	take(false, 500*time.Millisecond)
+
+	// A bucket stops filling once it's full.
+	clock.advance(time.Hour)
+	for i := 0; i < 4; i++ {
+		take(true, 0)
+	}
+	take(false, 500*time.Millisecond)
+
+	if allowed, _ := limiter.take("b", 1, clock.now()); !allowed {
+		t.Error("a second client shares the first one's bucket")
+	}
+}
+
+func TestRateLimiterCost(t *testing.T) {
+	clock := &clock{time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(1, 10)
+
+	tests := []struct {
+		name     string
+		cost     float64
+		advance  time.Duration
+		want     bool
+		wantWait time.Duration
+	}{
+		{"expensive route", 6, 0, true, 0},
+		{"not enough left", 6, 0, false, 2 * time.Second},
+		{"a refused request takes nothing", 4, 0, true, 0},
+		{"empty bucket", 1, 0, false, time.Second},
+		{"costs more than a full bucket", 20, 0, false, 10 * time.Second},
+		{"charged a full bucket", 20, 10 * time.Second, true, 0},
+	}
+
+	for _, test := range tests {
+		clock.advance(test.advance)
+		allowed, wait := limiter.take("a", test.cost, clock.now())
+		if allowed != test.want || wait != test.wantWait {
+			t.Errorf("%s: take = %v, %v; want %v, %v", test.name, allowed, wait, test.want, test.wantWait)
+		}
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := &clock{time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(2, 10)
+	limiter.now = clock.now
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if id := c.GetHeader("Key-Id"); id != "" {
+			c.Set("key", models.APIKey{Id: id, Name: "shared name"})
+		}
+	}, limitRequests(limiter))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/v1/leagues/:league_id/backtest", ok)
+	router.GET("/v1/leagues/:league_id", ok)
+
+	tests := []struct {
+		name       string
+		keyId      string
+		path       string
+		advance    time.Duration
+		want       int
+		retryAfter string
+	}{
+		{"expensive route", "", "/v1/leagues/a/backtest", 0, http.StatusOK, ""},
+		{"budget used up", "", "/v1/leagues/a", 0, http.StatusTooManyRequests, "1"},
+		{"partly refilled", "", "/v1/leagues/a/backtest", 3 * time.Second, http.StatusTooManyRequests, "2"},
+		{"cheap route once refilled", "", "/v1/leagues/a", 0, http.StatusOK, ""},
+		{"first key", "1", "/v1/leagues/a/backtest", 0, http.StatusOK, ""},
+		{"first key used up", "1", "/v1/leagues/a", 0, http.StatusTooManyRequests, "1"},
+		{"second key with the same name", "2", "/v1/leagues/a/backtest", 0, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		clock.advance(test.advance)
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.keyId != "" {
+			req.Header.Set("Key-Id", test.keyId)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("%s: GET %s answered %d, want %d", test.name, test.path, w.Code, test.want)
+		}
+		if got := w.Header().Get("Retry-After"); got != test.retryAfter {
+			t.Errorf("%s: Retry-After is %q, want %q", test.name, got, test.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// Logs are written to stderr as JSON, one object per line. Settings, from
+// the environment:
+//
+//	MLS_LOG_LEVEL   debug, info, warn or error (default info). At debug every
+//	                query is logged along with the request that ran it.
+//	MLS_SLOW_QUERY  queries that take at least this long are logged as
+//	                warnings, or 0 to log none (default 100ms)
+const (
+	logLevelEnv  = "MLS_LOG_LEVEL"
+	slowQueryEnv = "MLS_SLOW_QUERY"
+)
+
+// Clients can send their own request ID in this header, and it's sent back
+// with every response.
+const requestIdHeader = "X-Request-ID"
+
+// Request IDs sent by clients are only used if they look like one.
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Routes polled by monitoring are only logged at debug level.
+var quietRoutes = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+var slowQuery = 100 * time.Millisecond
+
+type requestIdKey struct{}
+
+// setupLogging makes the default logger write JSON at the configured level,
+// with the request ID of the context it's given.
+func setupLogging() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(envOrDefault(logLevelEnv, "info"))); err != nil {
+		fatalf("%s must be debug, info, warn or error", logLevelEnv)
+	}
+
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(requestIdHandler{handler}))
+
+	threshold, err := time.ParseDuration(envOrDefault(slowQueryEnv, slowQuery.String()))
+	if err != nil || threshold < 0 {
+		fatalf("%s must be a duration like 100ms", slowQueryEnv)
+	}
+	slowQuery = threshold
+}
+
+// requestIdHandler adds the request and trace IDs to everything logged while
+// handling a request, including from the queries it runs.
+type requestIdHandler struct {
+	slog.Handler
+}
+
+func (h requestIdHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id, ok := ctx.Value(requestIdKey{}).(string); ok {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if id := traceId(ctx); id != "" {
+		record.AddAttrs(slog.String("trace_id", id))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIdHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIdHandler) WithGroup(name string) slog.Handler {
+	return requestIdHandler{h.Handler.WithGroup(name)}
+}
+
+// identifyRequests gives each request an ID, keeping the one the client sent
+// if there is one, and adds it to the request's context.
+func identifyRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIdHeader)
+		if !validRequestId.MatchString(id) {
+			id = newRequestId()
+		}
+
+		c.Header(requestIdHeader, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIdKey{}, id))
+		c.Next()
+	}
+}
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	checkErr(err)
+
+	return hex.EncodeToString(b)
+}
+
+// logRequests logs each request once it has been answered.
+func logRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		status := c.Writer.Status()
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case quietRoutes[route]:
+			level = slog.LevelDebug
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if actor := c.GetString("actor"); actor != "" {
+			attrs = append(attrs, slog.String("actor", actor))
+		}
+		if errType := errorType(c); errType != "" {
+			attrs = append(attrs, slog.String("error", errType))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// recoverPanics answers requests whose handler panicked with a 500, logging
+// the panic in place of gin's free-form output.
+func recoverPanics() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		slog.ErrorContext(c.Request.Context(), "panic", "error", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// logQuery logs queries that were slow, and every query at debug level.
+func logQuery(ctx context.Context, query models.Query) {
+	level := slog.LevelDebug
+	msg := "query"
+	if slowQuery > 0 && query.Duration >= slowQuery {
+		level = slog.LevelWarn
+		msg = "slow query"
+	}
+
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("function", query.Func),
+		slog.String("sql", strings.Join(strings.Fields(query.SQL), " ")),
+		slog.Float64("duration_ms", float64(query.Duration.Microseconds())/1000),
+	}
+	if query.Err != nil {
+		attrs = append(attrs, slog.String("error", query.Err.Error()))
+	}
+
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// fatalf logs an error the server can't carry on after, and exits.
+func fatalf(format string, args ...interface{}) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
@@ -1,64 +1,212 @@
 package main
 
 import (
-	"log"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/charts"
 	"github.com/thePurpleMonkey/music-league-stats-server/models"
+	"github.com/thePurpleMonkey/music-league-stats-server/views"
 )
 
 func main() {
-	err := models.ConnectDatabase()
+	ctx := context.Background()
+
+	setupLogging()
+	setupTracing()
+	connectDatabase(ctx)
+
+	if len(os.Args) > 1 {
+		runCommand(ctx, os.Args[1], os.Args[2:])
+		checkErr(models.CloseDatabase())
+		return
+	}
+
+	models.ObserveQueries(serverMetrics.observeQuery)
+	models.ObserveQueries(logQuery)
+	models.ObserveQueries(traceQuery)
+
+	_, err := models.ScoreComments(ctx)
 	checkErr(err)
 
-	router := gin.Default()
+	serve(ctx, &http.Server{Addr: "localhost:4040", Handler: newRouter(loadLimits())}, shutdownDelay())
+	checkErr(models.CloseDatabase())
+}
+
+// serve runs the server until it's sent SIGINT or SIGTERM. It then reports
+// that it's shutting down for delay while still answering, stops taking new
+// connections and waits for the requests in flight to finish.
+func serve(ctx context.Context, server *http.Server, delay time.Duration) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		checkErr(err)
+	case <-ctx.Done():
+	}
+
+	// A second signal stops the server straight away.
+	stop()
+	shuttingDown.Store(true)
+	slog.Info("shutting down", slog.Float64("delay_ms", float64(delay.Microseconds())/1000))
+	time.Sleep(delay)
+
+	// Queries give up after queryTimeout, so requests should be done by then.
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout+5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("stopped before every request finished", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("stopped before every span was exported", "error", err)
+	}
+}
+
+// newRouter sets up the routes. Clients are rate limited by limiter, unless
+// it's nil.
+func newRouter(limiter *rateLimiter) *gin.Engine {
+	// Requests are logged and measured outside of recoverPanics, so ones that
+	// panic are too. Gin's own debug output would only duplicate those logs.
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(identifyRequests(), traceRequests(), logRequests(), measureRequests(serverMetrics), recoverPanics())
 	// router.Use(cors.Default())
 
-	group := router.Group("/v1")
+	checkErr(router.SetTrustedProxies(trustedProxies()))
+
+	addHealthRoutes(router)
+
+	// The metrics describe the server's traffic, so scrapers need an admin
+	// key, but they aren't rate limited or cut off like the API.
+	auth := authenticate(adminToken(), limiter)
+	router.GET("metrics", auth, requireScope(models.ScopeAdmin), metricsHandler(serverMetrics))
+
+	group := router.Group("/v1", limitQueryTime(), auth, limitRequests(limiter))
 	{
 		group.GET("leagues", getLeagues)
-		// group.GET("leagues/:league_id", getLeagueById)
-		group.GET("leagues/:league_id/rounds", getRounds)
-		group.GET("leagues/:league_id/members", getMembers)
-		group.GET("leagues/:league_id/members/:member_id/votes_received", getVotesReceived)
-		group.GET("leagues/:league_id/members/:member_id/votes_given", getVotesGiven)
-		group.GET("leagues/:league_id/members/:member_id/round_standings", getRoundStandings)
-		group.GET("leagues/:league_id/members/:member_id/favorite_songs", getFavoriteSongs)
-		group.GET("leagues/:league_id/similarity/:member_id", getLeagueSimilarity)
+	}
 
-		group.GET("submissions/:round_id", getSubmissions)
-		group.GET("voters/:round_id", getVotesByVoter)
-		group.GET("members", getAllMembers)
-		group.GET("members/:member_id", getMember)
-		group.GET("rounds/:round_id", getRound)
-		group.GET("rounds/:round_id/rankings", getRoundRankings)
-		group.GET("rounds/:round_id/members", getRoundMembers)
-		group.GET("rounds/:round_id/similarity/:member_id", getSimilarity)
+	league := group.Group("", requireLeague())
+	{
+		league.GET("leagues/:league_id", getLeagueById)
+		league.GET("leagues/:league_id/rounds", getRounds)
+		league.GET("leagues/:league_id/members", getMembers)
+		league.GET("leagues/:league_id/members/:member_id/votes_received", getVotesReceived)
+		league.GET("leagues/:league_id/members/:member_id/votes_given", getVotesGiven)
+		league.GET("leagues/:league_id/members/:member_id/round_standings", getRoundStandings)
+		league.GET("leagues/:league_id/members/:member_id/favorite_songs", getFavoriteSongs)
+		league.GET("leagues/:league_id/members/:member_id/voter_profile", getVoterProfile)
+		league.GET("leagues/:league_id/members/:member_id/wrapped", getMemberWrapped)
+		league.GET("leagues/:league_id/members/:member_id/charts/placements.svg", getPlacementsChart)
+		league.GET("leagues/:league_id/similarity/:member_id", getLeagueSimilarity)
+		league.GET("leagues/:league_id/backtest", getBacktest)
+		league.GET("leagues/:league_id/reciprocity", getReciprocity)
+		league.GET("leagues/:league_id/comments/stats", getCommentStats)
+		league.GET("leagues/:league_id/sentiment", getSentimentStats)
+		league.GET("leagues/:league_id/wrapped", getLeagueWrapped)
+		league.GET("leagues/:league_id/charts/standings.svg", getStandingsChart)
+		league.GET("leagues/:league_id/charts/similarity.svg", getSimilarityChart)
+
+		league.GET("submissions/:round_id", getSubmissions)
+		league.GET("voters/:round_id", getVotesByVoter)
+		league.GET("rounds/:round_id", getRound)
+		league.GET("rounds/:round_id/rankings", getRoundRankings)
+		league.GET("rounds/:round_id/members", getRoundMembers)
+		league.GET("rounds/:round_id/similarity/:member_id", getSimilarity)
+		league.GET("rounds/:round_id/predictions", getRoundPredictions)
+		league.GET("rounds/:round_id/charts/points.svg", getRoundPointsChart)
+		league.GET("rounds/:round_id/recap", getRoundRecap)
 	}
 
-	router.Run("localhost:4040")
+	// Members and search span every league.
+	everyLeague := group.Group("", requireAllLeagues())
+	{
+		everyLeague.GET("members", getAllMembers)
+		everyLeague.GET("ratings", getRatings)
+		everyLeague.GET("members/:member_id", getMember)
+		everyLeague.GET("members/:member_id/ratings", getMemberRatingHistory)
+		everyLeague.GET("members/:member_id/career", getCareer)
+		everyLeague.GET("members/:member_id/voter_profile", getMemberVoterProfile)
+
+		everyLeague.GET("search", search)
+	}
+
+	group.GET("search/comments", requireSearchLeague(), searchComments)
+
+	addWriteRoutes(group)
+	addAdminRoutes(group)
+
+	return router
 }
 
 func getLeagues(c *gin.Context) {
-	leagues, err := models.GetLeagues()
-	checkErr(err)
+	leagues, err := models.GetLeagues(c.Request.Context())
+	if queryFailed(c, err) {
+		return
+	}
+
+	// Private leagues are only listed for keys that can use them.
+	key, hasKey := callerKey(c)
+	visible := leagues[:0]
+	for _, league := range leagues {
+		if !league.Private || (hasKey && key.CanAccess(league.Id)) {
+			visible = append(visible, league)
+		}
+	}
+	leagues = visible
 
 	if leagues == nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, leagues)
 	}
 }
 
+func getLeagueById(c *gin.Context) {
+	leagueId := c.Param("league_id")
+	league, err := models.GetLeagueSummary(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if league.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, league)
+	}
+}
+
 func getRounds(c *gin.Context) {
 	leagueId := c.Param("league_id")
-	rounds, err := models.GetRounds(leagueId)
-	checkErr(err)
+	rounds, err := models.GetRounds(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if rounds == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, rounds)
@@ -66,11 +214,13 @@ func getRounds(c *gin.Context) {
 }
 
 func getAllMembers(c *gin.Context) {
-	members, err := models.GetAllMembers()
-	checkErr(err)
+	members, err := models.GetAllMembers(c.Request.Context())
+	if queryFailed(c, err) {
+		return
+	}
 
 	if members == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, members)
@@ -79,11 +229,13 @@ func getAllMembers(c *gin.Context) {
 
 func getRoundMembers(c *gin.Context) {
 	roundId := c.Param("round_id")
-	members, err := models.GetRoundMembers(roundId)
-	checkErr(err)
+	members, err := models.GetRoundMembers(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if members == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, members)
@@ -92,11 +244,13 @@ func getRoundMembers(c *gin.Context) {
 
 func getMembers(c *gin.Context) {
 	leagueId := c.Param("league_id")
-	members, err := models.GetMembers(leagueId)
-	checkErr(err)
+	members, err := models.GetMembers(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if members == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, members)
@@ -105,11 +259,13 @@ func getMembers(c *gin.Context) {
 
 func getRound(c *gin.Context) {
 	roundId := c.Param("round_id")
-	round, err := models.GetRoundById(roundId)
-	checkErr(err)
+	round, err := models.GetRoundById(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if round.Id == "" {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, round)
@@ -118,11 +274,13 @@ func getRound(c *gin.Context) {
 
 func getRoundRankings(c *gin.Context) {
 	roundId := c.Param("round_id")
-	rankings, err := models.GetRoundRankings(roundId)
-	checkErr(err)
+	rankings, err := models.GetRoundRankings(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if rankings == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, rankings)
@@ -131,11 +289,13 @@ func getRoundRankings(c *gin.Context) {
 
 func getMember(c *gin.Context) {
 	memberId := c.Param("member_id")
-	member, err := models.GetMemberById(memberId)
-	checkErr(err)
+	member, err := models.GetMemberById(c.Request.Context(), memberId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if member.Id == "" {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, member)
@@ -145,11 +305,13 @@ func getMember(c *gin.Context) {
 func getVotesReceived(c *gin.Context) {
 	leagueId := c.Param("league_id")
 	memberId := c.Param("member_id")
-	votes, err := models.GetVotesReceived(leagueId, memberId)
-	checkErr(err)
+	votes, err := models.GetVotesReceived(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if votes == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, votes)
@@ -159,11 +321,13 @@ func getVotesReceived(c *gin.Context) {
 func getVotesGiven(c *gin.Context) {
 	leagueId := c.Param("league_id")
 	memberId := c.Param("member_id")
-	votes, err := models.GetVotesGiven(leagueId, memberId)
-	checkErr(err)
+	votes, err := models.GetVotesGiven(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if votes == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, votes)
@@ -173,11 +337,13 @@ func getVotesGiven(c *gin.Context) {
 func getRoundStandings(c *gin.Context) {
 	leagueId := c.Param("league_id")
 	memberId := c.Param("member_id")
-	votes, err := models.GetRoundStandings(leagueId, memberId)
-	checkErr(err)
+	votes, err := models.GetRoundStandings(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if votes == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, votes)
@@ -187,11 +353,13 @@ func getRoundStandings(c *gin.Context) {
 func getFavoriteSongs(c *gin.Context) {
 	leagueId := c.Param("league_id")
 	memberId := c.Param("member_id")
-	votes, err := models.GetFavoriteSongs(leagueId, memberId)
-	checkErr(err)
+	votes, err := models.GetFavoriteSongs(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if votes == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, votes)
@@ -200,11 +368,13 @@ func getFavoriteSongs(c *gin.Context) {
 
 func getSubmissions(c *gin.Context) {
 	roundId := c.Param("round_id")
-	round, err := models.GetSubmissions(roundId)
-	checkErr(err)
+	round, err := models.GetSubmissions(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if round == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, round)
@@ -213,11 +383,13 @@ func getSubmissions(c *gin.Context) {
 
 func getVotesByVoter(c *gin.Context) {
 	roundId := c.Param("round_id")
-	round, err := models.GetVotesByVoter(roundId)
-	checkErr(err)
+	round, err := models.GetVotesByVoter(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if round == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, round)
@@ -227,11 +399,13 @@ func getVotesByVoter(c *gin.Context) {
 func getSimilarity(c *gin.Context) {
 	roundId := c.Param("round_id")
 	memberId := c.Param("member_id")
-	similarities, err := models.GetSimilarity(roundId, memberId)
-	checkErr(err)
+	similarities, err := models.GetSimilarity(c.Request.Context(), roundId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if similarities == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, similarities)
@@ -241,19 +415,515 @@ func getSimilarity(c *gin.Context) {
 func getLeagueSimilarity(c *gin.Context) {
 	leagueId := c.Param("league_id")
 	memberId := c.Param("member_id")
-	similarities, err := models.GetLeagueSimilarity(leagueId, memberId)
-	checkErr(err)
+	similarities, err := models.GetLeagueSimilarity(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
 
 	if similarities == nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "No Records Found"})
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
 		return
 	} else {
 		c.IndentedJSON(http.StatusOK, similarities)
 	}
 }
 
+func getRoundPredictions(c *gin.Context) {
+	roundId := c.Param("round_id")
+	predictions, err := models.PredictRound(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if predictions == nil {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, predictions)
+	}
+}
+
+func getBacktest(c *gin.Context) {
+	leagueId := c.Param("league_id")
+	backtest, err := models.BacktestLeague(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if backtest.League.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, backtest)
+	}
+}
+
+func getRatings(c *gin.Context) {
+	ratings, err := models.GetRatings(c.Request.Context())
+	if queryFailed(c, err) {
+		return
+	}
+
+	if len(ratings) == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, ratings)
+	}
+}
+
+func getMemberRatingHistory(c *gin.Context) {
+	memberId := c.Param("member_id")
+	history, err := models.GetMemberRatingHistory(c.Request.Context(), memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if history == nil {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, history)
+	}
+}
+
+func getCareer(c *gin.Context) {
+	memberId := c.Param("member_id")
+	career, err := models.GetCareer(c.Request.Context(), memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if career.Member.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, career)
+	}
+}
+
+func getVoterProfile(c *gin.Context) {
+	leagueId := c.Param("league_id")
+	memberId := c.Param("member_id")
+	profile, err := models.GetVoterProfile(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if profile.Rounds == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, profile)
+	}
+}
+
+func getMemberVoterProfile(c *gin.Context) {
+	memberId := c.Param("member_id")
+	profile, err := models.GetMemberVoterProfile(c.Request.Context(), memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if profile.Rounds == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, profile)
+	}
+}
+
+func getReciprocity(c *gin.Context) {
+	leagueId := c.Param("league_id")
+
+	iterations, err := strconv.Atoi(c.DefaultQuery("iterations", strconv.Itoa(models.DefaultReciprocityIterations)))
+	if err != nil || iterations < 0 || iterations > 10000 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "iterations must be a number between 0 and 10000"))
+		return
+	}
+
+	alpha, err := strconv.ParseFloat(c.DefaultQuery("alpha", strconv.FormatFloat(models.DefaultReciprocityAlpha, 'f', -1, 64)), 64)
+	if err != nil || alpha <= 0 || alpha >= 1 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "alpha must be a number between 0 and 1"))
+		return
+	}
+
+	graph, err := models.GetReciprocity(c.Request.Context(), leagueId, iterations, alpha)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if graph.Nodes == nil {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, graph)
+	}
+}
+
+func getCommentStats(c *gin.Context) {
+	leagueId := c.Param("league_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "limit must be a number between 1 and 500"))
+		return
+	}
+
+	stats, err := models.GetCommentStats(c.Request.Context(), leagueId, limit)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if stats.League.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, stats)
+	}
+}
+
+func getSentimentStats(c *gin.Context) {
+	leagueId := c.Param("league_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "limit must be a number between 1 and 100"))
+		return
+	}
+
+	stats, err := models.GetSentimentStats(c.Request.Context(), leagueId, limit)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if stats.League.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, stats)
+	}
+}
+
+func search(c *gin.Context) {
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "q is required"))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "limit must be a number between 1 and 100"))
+		return
+	}
+
+	var types []string
+	if c.Query("type") != "" {
+		types = strings.Split(c.Query("type"), ",")
+		for _, t := range types {
+			if !slices.Contains(models.SearchTypes, t) {
+				c.IndentedJSON(http.StatusBadRequest, errorBody(c, "type must be one of "+strings.Join(models.SearchTypes, ", ")))
+				return
+			}
+		}
+	}
+
+	hits, err := models.Search(c.Request.Context(), query, types, limit)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if len(hits) == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, hits)
+	}
+}
+
+func searchComments(c *gin.Context) {
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "q is required"))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "limit must be a number between 1 and 100"))
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "offset must be a positive number"))
+		return
+	}
+
+	hits, err := models.SearchComments(c.Request.Context(), query, models.CommentSearchFilter{
+		LeagueId:    c.Query("league_id"),
+		RoundId:     c.Query("round_id"),
+		VoterId:     c.Query("voter_id"),
+		RecipientId: c.Query("recipient_id"),
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err == models.ErrSearchUnavailable {
+		c.IndentedJSON(http.StatusNotImplemented, errorBody(c, err.Error()))
+		return
+	}
+	if queryFailed(c, err) {
+		return
+	}
+
+	if len(hits) == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else {
+		c.IndentedJSON(http.StatusOK, hits)
+	}
+}
+
+func getLeagueWrapped(c *gin.Context) {
+	leagueId := c.Param("league_id")
+	wrapped, err := models.GetLeagueWrapped(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if wrapped.League.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else if c.Query("format") == "html" {
+		renderHTML(c, func(w io.Writer) error { return views.LeagueWrapped(w, wrapped) })
+	} else {
+		c.IndentedJSON(http.StatusOK, wrapped)
+	}
+}
+
+func getMemberWrapped(c *gin.Context) {
+	leagueId := c.Param("league_id")
+	memberId := c.Param("member_id")
+	wrapped, err := models.GetMemberWrapped(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if wrapped.Member.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	} else if c.Query("format") == "html" {
+		renderHTML(c, func(w io.Writer) error { return views.MemberWrapped(w, wrapped) })
+	} else {
+		c.IndentedJSON(http.StatusOK, wrapped)
+	}
+}
+
+// renderHTML renders a page into a buffer first, so a template error doesn't
+// leave a half-written page.
+func renderHTML(c *gin.Context, render func(w io.Writer) error) {
+	var page bytes.Buffer
+	if renderFailed(c, render(&page)) {
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// renderFailed responds to a response that couldn't be rendered and reports
+// whether it couldn't. The error is logged with the request's ID.
+func renderFailed(c *gin.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	slog.ErrorContext(c.Request.Context(), "rendering failed", "error", err)
+	c.IndentedJSON(http.StatusInternalServerError, errorBody(c, "the response couldn't be rendered"))
+	return true
+}
+
+func getStandingsChart(c *gin.Context) {
+	opts, ok := chartOptions(c, 640, 360)
+	if !ok {
+		return
+	}
+
+	leagueId := c.Param("league_id")
+	history, err := models.GetStandingsHistory(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if history.League.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	}
+
+	labels := make([]string, len(history.Rounds))
+	for i := range history.Rounds {
+		labels[i] = strconv.Itoa(i + 1)
+	}
+
+	series := make([]charts.Series, len(history.Members))
+	for i, standings := range history.Members {
+		series[i] = charts.Series{Name: standings.Member.Name, Values: make([]float64, len(standings.Points))}
+		for j, points := range standings.Points {
+			series[i].Values[j] = float64(points)
+		}
+	}
+
+	renderSVG(c, func(w io.Writer) error { return charts.Line(w, opts, labels, series) })
+}
+
+func getSimilarityChart(c *gin.Context) {
+	opts, ok := chartOptions(c, 600, 600)
+	if !ok {
+		return
+	}
+
+	leagueId := c.Param("league_id")
+	matrix, err := models.GetLeagueSimilarityMatrix(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if len(matrix.Members) == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	}
+
+	labels := make([]string, len(matrix.Members))
+	values := make([][]float64, len(matrix.Members))
+	for i, member := range matrix.Members {
+		labels[i] = member.Name
+		values[i] = make([]float64, len(matrix.Values[i]))
+		for j, value := range matrix.Values[i] {
+			values[i][j] = float64(value)
+		}
+	}
+
+	renderSVG(c, func(w io.Writer) error { return charts.Heatmap(w, opts, labels, values) })
+}
+
+func getPlacementsChart(c *gin.Context) {
+	opts, ok := chartOptions(c, 160, 50)
+	if !ok {
+		return
+	}
+
+	leagueId := c.Param("league_id")
+	memberId := c.Param("member_id")
+	standings, err := models.GetRoundStandings(c.Request.Context(), leagueId, memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if len(standings) == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	}
+
+	placements := make([]float64, len(standings))
+	for i, standing := range standings {
+		placements[i] = float64(standing.Placement)
+	}
+
+	renderSVG(c, func(w io.Writer) error { return charts.Sparkline(w, opts, placements, true) })
+}
+
+func getRoundPointsChart(c *gin.Context) {
+	opts, ok := chartOptions(c, 640, 480)
+	if !ok {
+		return
+	}
+
+	roundId := c.Param("round_id")
+	rankings, err := models.GetRoundRankings(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if len(rankings) == 0 {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	}
+
+	labels := make([]string, len(rankings))
+	points := make([]float64, len(rankings))
+	for i, ranking := range rankings {
+		labels[i] = ranking.Member.Name
+		points[i] = float64(ranking.Votes)
+	}
+
+	renderSVG(c, func(w io.Writer) error { return charts.Bar(w, opts, labels, points) })
+}
+
+func getRoundRecap(c *gin.Context) {
+	format := c.DefaultQuery("format", "markdown")
+	if !slices.Contains(views.RecapFormats, format) {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "format must be one of "+strings.Join(views.RecapFormats, ", ")))
+		return
+	}
+
+	roundId := c.Param("round_id")
+	recap, err := models.GetRoundRecap(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	if recap.Round.Id == "" {
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+		return
+	}
+
+	var text bytes.Buffer
+	if renderFailed(c, views.RoundRecap(&text, recap, format)) {
+		return
+	}
+
+	contentType := "text/markdown; charset=utf-8"
+	if format == "text" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	c.Data(http.StatusOK, contentType, text.Bytes())
+}
+
+// chartOptions reads the width, height and theme parameters of a chart
+// request, responding with an error if they aren't valid.
+func chartOptions(c *gin.Context, defaultWidth int, defaultHeight int) (charts.Options, bool) {
+	width, err := strconv.Atoi(c.DefaultQuery("width", strconv.Itoa(defaultWidth)))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "width must be a number"))
+		return charts.Options{}, false
+	}
+
+	height, err := strconv.Atoi(c.DefaultQuery("height", strconv.Itoa(defaultHeight)))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, "height must be a number"))
+		return charts.Options{}, false
+	}
+
+	opts, err := charts.NewOptions(width, height, c.DefaultQuery("theme", "light"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, err.Error()))
+		return charts.Options{}, false
+	}
+
+	return opts, true
+}
+
+func renderSVG(c *gin.Context, render func(w io.Writer) error) {
+	var image bytes.Buffer
+	if renderFailed(c, render(&image)) {
+		return
+	}
+
+	c.Data(http.StatusOK, "image/svg+xml", image.Bytes())
+}
+
 func checkErr(err error) {
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
 	}
 }
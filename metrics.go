@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// Bucket bounds in seconds. Most requests take tens of milliseconds and most
+// queries well under one.
+var (
+	requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	queryBuckets   = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+)
+
+// errorTypes names the errors counted for each status. Other 4xx statuses
+// are "client_error" and other 5xx ones "internal".
+var errorTypes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// metrics holds the series served at /metrics, in a registry of their own
+// along with the Go runtime and process collectors.
+type metrics struct {
+	registry     *prometheus.Registry
+	requests     *prometheus.CounterVec
+	requestTimes *prometheus.HistogramVec
+	errors       *prometheus.CounterVec
+	queryTimes   *prometheus.HistogramVec
+	queryErrors  *prometheus.CounterVec
+}
+
+var serverMetrics = newMetrics()
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mls_http_requests_total",
+			Help: "Requests answered, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestTimes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mls_http_request_duration_seconds",
+			Help:    "How long requests took to answer, by route.",
+			Buckets: requestBuckets,
+		}, []string{"route"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mls_http_errors_total",
+			Help: "Requests that failed, by why.",
+		}, []string{"type"}),
+		queryTimes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mls_db_query_duration_seconds",
+			Help:    "How long queries took to run and read, by model function.",
+			Buckets: queryBuckets,
+		}, []string{"function"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mls_db_query_errors_total",
+			Help: "Queries that failed, by model function.",
+		}, []string{"function"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.requestTimes, m.errors, m.queryTimes, m.queryErrors,
+		newDatabaseCollector(),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// measureRequests counts each request by route, and how long it took.
+func measureRequests(m *metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Requests that didn't match a route are lumped together, so clients
+		// can't make up new series.
+		route, method := c.FullPath(), c.Request.Method
+		if route == "" {
+			route, method = "unmatched", "other"
+		}
+
+		m.requests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		m.requestTimes.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		if errType := errorType(c); errType != "" {
+			m.errors.WithLabelValues(errType).Inc()
+		}
+	}
+}
+
+// errorType says why a request failed, or returns an empty string if it
+// didn't.
+func errorType(c *gin.Context) string {
+	for _, err := range c.Errors {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return "timeout"
+		case errors.Is(err, context.Canceled):
+			return "canceled"
+		}
+	}
+
+	status := c.Writer.Status()
+	switch {
+	case errorTypes[status] != "":
+		return errorTypes[status]
+	case status >= http.StatusInternalServerError:
+		return "internal"
+	case status >= http.StatusBadRequest:
+		return "client_error"
+	}
+
+	return ""
+}
+
+func (m *metrics) observeQuery(ctx context.Context, query models.Query) {
+	m.queryTimes.WithLabelValues(query.Func).Observe(query.Duration.Seconds())
+
+	if query.Err != nil {
+		m.queryErrors.WithLabelValues(query.Func).Inc()
+	}
+}
+
+// metricsHandler serves the metrics in whichever format the scraper asks for.
+func metricsHandler(m *metrics) gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// databaseCollector reads the connection pool and import state when the
+// metrics are scraped.
+type databaseCollector struct {
+	cacheHits     *prometheus.Desc
+	cacheMisses   *prometheus.Desc
+	connections   *prometheus.Desc
+	waits         *prometheus.Desc
+	waitTime      *prometheus.Desc
+	importRunning *prometheus.Desc
+	lastImportAge *prometheus.Desc
+}
+
+func newDatabaseCollector() *databaseCollector {
+	return &databaseCollector{
+		cacheHits: prometheus.NewDesc("mls_statement_cache_hits_total",
+			"Prepared statements run on a connection they were already prepared on.", nil, nil),
+		cacheMisses: prometheus.NewDesc("mls_statement_cache_misses_total",
+			"Prepared statements that had to be prepared on their connection first.", nil, nil),
+		connections: prometheus.NewDesc("mls_db_connections",
+			"Open database connections, by whether they're in use.", []string{"state"}, nil),
+		waits: prometheus.NewDesc("mls_db_connection_waits_total",
+			"Times a query waited for a free connection.", nil, nil),
+		waitTime: prometheus.NewDesc("mls_db_connection_wait_seconds_total",
+			"Time spent waiting for a free connection.", nil, nil),
+		importRunning: prometheus.NewDesc("mls_import_running",
+			"Whether an import is writing to the database.", nil, nil),
+		lastImportAge: prometheus.NewDesc("mls_last_import_age_seconds",
+			"Time since the last import finished.", nil, nil),
+	}
+}
+
+func (d *databaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.cacheHits
+	ch <- d.cacheMisses
+	ch <- d.connections
+	ch <- d.waits
+	ch <- d.waitTime
+	ch <- d.importRunning
+	ch <- d.lastImportAge
+}
+
+func (d *databaseCollector) Collect(ch chan<- prometheus.Metric) {
+	if models.DB == nil {
+		return
+	}
+
+	hits, misses := models.StatementCacheStats()
+	ch <- prometheus.MustNewConstMetric(d.cacheHits, prometheus.CounterValue, float64(hits))
+	ch <- prometheus.MustNewConstMetric(d.cacheMisses, prometheus.CounterValue, float64(misses))
+
+	stats := models.DB.Stats()
+	ch <- prometheus.MustNewConstMetric(d.connections, prometheus.GaugeValue, float64(stats.InUse), "in_use")
+	ch <- prometheus.MustNewConstMetric(d.connections, prometheus.GaugeValue, float64(stats.Idle), "idle")
+	ch <- prometheus.MustNewConstMetric(d.waits, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(d.waitTime, prometheus.CounterValue, stats.WaitDuration.Seconds())
+
+	// Freshness is left out if the database can't say, rather than failing
+	// the whole scrape.
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+
+	if running, err := models.ImportRunning(ctx); err == nil {
+		ch <- prometheus.MustNewConstMetric(d.importRunning, prometheus.GaugeValue, float64(boolToInt(running)))
+	}
+	if last, err := models.LastImport(ctx); err == nil && last != nil {
+		ch <- prometheus.MustNewConstMetric(d.lastImportAge, prometheus.GaugeValue, time.Since(*last).Seconds())
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
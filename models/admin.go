@@ -0,0 +1,456 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Actor identifies who made a change. Name is the credential it was made
+// with, as checked by the server. ReportedName is who the caller says they
+// are, which can't be checked and is only recorded alongside.
+type Actor struct {
+	Name         string
+	ReportedName string
+}
+
+type AuditEntry struct {
+	Id            int64           `json:"id"`
+	Actor         string          `json:"actor"`
+	ReportedActor string          `json:"reported_actor,omitempty"`
+	Action        string          `json:"action"`
+	Target        string          `json:"target"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+type AuditFilter struct {
+	Action string
+	Target string
+	Limit  int
+	Offset int
+}
+
+// MergeMembers moves every submission, vote and league membership of one
+// member to another, then deletes the first. It's for people who ended up
+// with two accounts, so it refuses to merge members who both submitted or
+// both voted in the same round, or who voted for each other.
+func MergeMembers(ctx context.Context, actor Actor, sourceId string, targetId string) (_ AuditEntry, err error) {
+	ctx, span := startSpan(ctx, "MergeMembers")
+	defer endSpan(span, &err)
+
+	if sourceId == targetId {
+		return AuditEntry{}, invalid("can't merge a member into themselves")
+	}
+
+	var entry AuditEntry
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		source, err := memberTx(ctx, tx, sourceId)
+		if err != nil {
+			return err
+		}
+		target, err := memberTx(ctx, tx, targetId)
+		if err != nil {
+			return err
+		}
+
+		var roundId string
+		err = tx.QueryRowContext(ctx, `SELECT a.round_id FROM submissions a JOIN submissions b ON a.round_id = b.round_id
+			WHERE a.submitter_id = ? AND b.submitter_id = ?
+			UNION SELECT a.round_id FROM results a JOIN results b ON a.round_id = b.round_id
+			WHERE a.voter_id = ? AND b.voter_id = ?
+			UNION SELECT round_id FROM results
+			WHERE (voter_id = ? AND recipient_id = ?) OR (voter_id = ? AND recipient_id = ?)
+			LIMIT 1`, sourceId, targetId, sourceId, targetId, sourceId, targetId, targetId, sourceId).Scan(&roundId)
+		if err == nil {
+			return invalid("both members took part in round %s; fix that round before merging", roundId)
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+
+		before := struct {
+			Source      Member             `json:"source"`
+			Target      Member             `json:"target"`
+			Submissions []mergedSubmission `json:"submissions"`
+			Votes       []mergedVote       `json:"votes"`
+			LeagueIds   []string           `json:"league_ids"`
+		}{Source: source, Target: target}
+		if before.Submissions, err = memberSubmissions(ctx, tx, sourceId); err != nil {
+			return err
+		}
+		if before.Votes, err = memberVotes(ctx, tx, sourceId); err != nil {
+			return err
+		}
+		if before.LeagueIds, err = memberLeagues(ctx, tx, sourceId); err != nil {
+			return err
+		}
+
+		if err = execAll(ctx, tx, []string{
+			"UPDATE submissions SET submitter_id = ?2 WHERE submitter_id = ?1",
+			"UPDATE results SET voter_id = ?2 WHERE voter_id = ?1",
+			"UPDATE results SET recipient_id = ?2 WHERE recipient_id = ?1",
+			"UPDATE comment_sentiment SET voter_id = ?2 WHERE voter_id = ?1",
+			"UPDATE comment_sentiment SET recipient_id = ?2 WHERE recipient_id = ?1",
+			"INSERT OR IGNORE INTO league_members(league_id, member_id) SELECT league_id, ?2 FROM league_members WHERE member_id = ?1",
+			"DELETE FROM league_members WHERE member_id = ?1",
+			"DELETE FROM members WHERE id = ?1",
+		}, sourceId, targetId); err != nil {
+			return err
+		}
+
+		entry, err = recordAudit(ctx, tx, actor, "merge_members", targetId, before, struct {
+			Target Member `json:"target"`
+		}{target})
+		return err
+	})
+
+	return entry, err
+}
+
+// ReassignSubmission gives a submission, and the votes it received, to a
+// different member of the league.
+func ReassignSubmission(ctx context.Context, actor Actor, roundId string, fromId string, toId string) (_ AuditEntry, err error) {
+	ctx, span := startSpan(ctx, "ReassignSubmission")
+	defer endSpan(span, &err)
+
+	if fromId == toId {
+		return AuditEntry{}, invalid("the submission already belongs to %s", toId)
+	}
+
+	var entry AuditEntry
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		leagueId, err := roundLeague(ctx, tx, roundId)
+		if err != nil {
+			return err
+		}
+
+		var trackId string
+		err = tx.QueryRowContext(ctx, "SELECT track_id FROM submissions WHERE round_id = ? AND submitter_id = ? LIMIT 1", roundId, fromId).Scan(&trackId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err = requireLeagueMember(ctx, tx, leagueId, toId); err != nil {
+			return err
+		}
+		if taken, err := exists(ctx, tx, "SELECT 1 FROM submissions WHERE round_id = ? AND submitter_id = ?", roundId, toId); err != nil || taken {
+			if err == nil {
+				err = invalid("%s already has a submission in this round", toId)
+			}
+			return err
+		}
+		if voted, err := exists(ctx, tx, "SELECT 1 FROM results WHERE round_id = ? AND voter_id = ? AND recipient_id = ?", roundId, toId, fromId); err != nil || voted {
+			if err == nil {
+				err = invalid("%s voted for this submission, so it can't be theirs", toId)
+			}
+			return err
+		}
+
+		if err = execAll(ctx, tx, []string{
+			"UPDATE submissions SET submitter_id = ?3 WHERE round_id = ?1 AND submitter_id = ?2",
+			"UPDATE results SET recipient_id = ?3 WHERE round_id = ?1 AND recipient_id = ?2",
+			"UPDATE comment_sentiment SET recipient_id = ?3 WHERE round_id = ?1 AND recipient_id = ?2",
+		}, roundId, fromId, toId); err != nil {
+			return err
+		}
+
+		type submission struct {
+			RoundId     string `json:"round_id"`
+			SubmitterId string `json:"submitter_id"`
+			TrackId     string `json:"track_id"`
+		}
+		entry, err = recordAudit(ctx, tx, actor, "reassign_submission", roundId,
+			submission{roundId, fromId, trackId}, submission{roundId, toId, trackId})
+		return err
+	})
+
+	return entry, err
+}
+
+// RenameRound changes the name of a round.
+func RenameRound(ctx context.Context, actor Actor, roundId string, name string) (_ AuditEntry, err error) {
+	ctx, span := startSpan(ctx, "RenameRound")
+	defer endSpan(span, &err)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return AuditEntry{}, invalid("name is required")
+	}
+
+	var entry AuditEntry
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		var before string
+		err := tx.QueryRowContext(ctx, "SELECT name FROM rounds WHERE id = ?", roundId).Scan(&before)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE rounds SET name = ? WHERE id = ?", name, roundId); err != nil {
+			return err
+		}
+
+		type round struct {
+			Name string `json:"name"`
+		}
+		entry, err = recordAudit(ctx, tx, actor, "rename_round", roundId, round{before}, round{name})
+		return err
+	})
+
+	return entry, err
+}
+
+// DeleteTrack removes a duplicate track. A track that has been submitted or
+// voted for can only be deleted in favour of a replacement, which takes over
+// its submissions and votes.
+func DeleteTrack(ctx context.Context, actor Actor, trackId string, replacementId string) (_ AuditEntry, err error) {
+	ctx, span := startSpan(ctx, "DeleteTrack")
+	defer endSpan(span, &err)
+
+	if trackId == replacementId {
+		return AuditEntry{}, invalid("a track can't replace itself")
+	}
+
+	var entry AuditEntry
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		before := struct {
+			Id         string   `json:"id"`
+			Name       string   `json:"name"`
+			Album      string   `json:"album"`
+			Picture    string   `json:"picture"`
+			ArtistIds  []string `json:"artist_ids"`
+			References int      `json:"references"`
+		}{ArtistIds: make([]string, 0)}
+
+		err := tx.QueryRowContext(ctx, "SELECT id, name, COALESCE(album, ''), COALESCE(picture, '') FROM track_names WHERE id = ?", trackId).
+			Scan(&before.Id, &before.Name, &before.Album, &before.Picture)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, "SELECT artist_id FROM track_artists WHERE track_id = ? ORDER BY artist_id", trackId)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var artistId string
+			if err = rows.Scan(&artistId); err != nil {
+				rows.Close()
+				return err
+			}
+			before.ArtistIds = append(before.ArtistIds, artistId)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if err = tx.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM submissions WHERE track_id = ?1) + (SELECT COUNT(*) FROM results WHERE track_id = ?1)", trackId).
+			Scan(&before.References); err != nil {
+			return err
+		}
+
+		if replacementId == "" {
+			if before.References > 0 {
+				return invalid("track %s has been submitted; give a replacement track to move its submissions to", trackId)
+			}
+		} else {
+			if found, err := exists(ctx, tx, "SELECT 1 FROM track_names WHERE id = ?", replacementId); err != nil || !found {
+				if err == nil {
+					err = invalid("replacement track %s doesn't exist", replacementId)
+				}
+				return err
+			}
+			if err = execAll(ctx, tx, []string{
+				"UPDATE submissions SET track_id = ?2 WHERE track_id = ?1",
+				"UPDATE results SET track_id = ?2 WHERE track_id = ?1",
+			}, trackId, replacementId); err != nil {
+				return err
+			}
+		}
+
+		if err = execAll(ctx, tx, []string{
+			"DELETE FROM track_artists WHERE track_id = ?",
+			"DELETE FROM track_names WHERE id = ?",
+		}, trackId); err != nil {
+			return err
+		}
+
+		entry, err = recordAudit(ctx, tx, actor, "delete_track", trackId, before, struct {
+			ReplacedBy string `json:"replaced_by,omitempty"`
+		}{replacementId})
+		return err
+	})
+
+	return entry, err
+}
+
+// GetAuditLog returns entries from the audit log, newest first.
+func GetAuditLog(ctx context.Context, filter AuditFilter) (_ []AuditEntry, err error) {
+	ctx, span := startSpan(ctx, "GetAuditLog")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, `SELECT id, actor, COALESCE(reported_actor, ''), action, target, before, after, created_at FROM audit_log
+		WHERE (? = '' OR action = ?) AND (? = '' OR target = ?)
+		ORDER BY id DESC LIMIT ? OFFSET ?`,
+		filter.Action, filter.Action, filter.Target, filter.Target, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0)
+
+	for rows.Next() {
+		entry := AuditEntry{}
+		var before, after string
+		if err = rows.Scan(&entry.Id, &entry.Actor, &entry.ReportedActor, &entry.Action, &entry.Target, &before, &after, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.Before = json.RawMessage(before)
+		entry.After = json.RawMessage(after)
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// recordAudit appends an entry to the audit log as part of the change it
+// describes, so the change and its record commit or roll back together.
+func recordAudit(ctx context.Context, tx *sql.Tx, actor Actor, action string, target string, before interface{}, after interface{}) (AuditEntry, error) {
+	entry := AuditEntry{
+		Actor:         actor.Name,
+		ReportedActor: actor.ReportedName,
+		Action:        action,
+		Target:        target,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+
+	var err error
+	if entry.Before, err = json.Marshal(before); err != nil {
+		return AuditEntry{}, err
+	}
+	if entry.After, err = json.Marshal(after); err != nil {
+		return AuditEntry{}, err
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO audit_log(actor, reported_actor, action, target, before, after, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		entry.Actor, entry.ReportedActor, entry.Action, entry.Target, string(entry.Before), string(entry.After), entry.CreatedAt)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	if entry.Id, err = result.LastInsertId(); err != nil {
+		return AuditEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// mergedSubmission and mergedVote are the rows MergeMembers moves, recorded in
+// full so a merge can be undone from the audit log.
+type mergedSubmission struct {
+	LeagueId string `json:"league_id"`
+	RoundId  string `json:"round_id"`
+	TrackId  string `json:"track_id"`
+	Comment  string `json:"comment"`
+}
+
+type mergedVote struct {
+	LeagueId    string `json:"league_id"`
+	RoundId     string `json:"round_id"`
+	VoterId     string `json:"voter_id"`
+	RecipientId string `json:"recipient_id"`
+	Votes       int    `json:"votes"`
+	TrackId     string `json:"track_id"`
+	Comment     string `json:"comment"`
+}
+
+func memberSubmissions(ctx context.Context, tx *sql.Tx, memberId string) ([]mergedSubmission, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT league_id, round_id, track_id, COALESCE(comment, '') FROM submissions
+		WHERE submitter_id = ? ORDER BY league_id, round_id, track_id`, memberId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	submissions := make([]mergedSubmission, 0)
+	for rows.Next() {
+		var s mergedSubmission
+		if err := rows.Scan(&s.LeagueId, &s.RoundId, &s.TrackId, &s.Comment); err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, s)
+	}
+
+	return submissions, rows.Err()
+}
+
+// memberVotes returns the votes a member cast and the votes they received.
+func memberVotes(ctx context.Context, tx *sql.Tx, memberId string) ([]mergedVote, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT league_id, round_id, voter_id, recipient_id, CAST(votes AS INTEGER), track_id, COALESCE(comment, '')
+		FROM results WHERE voter_id = ?1 OR recipient_id = ?1 ORDER BY league_id, round_id, voter_id, recipient_id`, memberId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := make([]mergedVote, 0)
+	for rows.Next() {
+		var v mergedVote
+		if err := rows.Scan(&v.LeagueId, &v.RoundId, &v.VoterId, &v.RecipientId, &v.Votes, &v.TrackId, &v.Comment); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+
+	return votes, rows.Err()
+}
+
+func memberLeagues(ctx context.Context, tx *sql.Tx, memberId string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT league_id FROM league_members WHERE member_id = ? ORDER BY league_id", memberId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leagueIds := make([]string, 0)
+	for rows.Next() {
+		var leagueId string
+		if err := rows.Scan(&leagueId); err != nil {
+			return nil, err
+		}
+		leagueIds = append(leagueIds, leagueId)
+	}
+
+	return leagueIds, rows.Err()
+}
+
+func memberTx(ctx context.Context, tx *sql.Tx, memberId string) (Member, error) {
+	member := Member{}
+	err := tx.QueryRowContext(ctx, "SELECT id, name, picture FROM members WHERE id = ?", memberId).Scan(&member.Id, &member.Name, &member.Picture)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Member{}, ErrNotFound
+		}
+		return Member{}, err
+	}
+
+	return member, nil
+}
@@ -0,0 +1,302 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists the scopes an API key can have. Each one allows everything
+// the ones before it do.
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Every key starts with this, so leaked keys are easy to search for.
+const apiKeyPrefix = "mls_"
+
+type APIKey struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// AllLeagues is set for keys that can use every league. Other keys can
+	// only use the leagues in LeagueIds, which may be none of them.
+	AllLeagues bool       `json:"all_leagues"`
+	LeagueIds  []string   `json:"league_ids"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key has the scope, or one that includes it.
+func (key APIKey) HasScope(scope string) bool {
+	needed := scopeRank(scope)
+	if needed < 0 {
+		return false
+	}
+
+	for _, s := range key.Scopes {
+		if scopeRank(s) >= needed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAccess reports whether the key can use a league.
+func (key APIKey) CanAccess(leagueId string) bool {
+	return key.AllLeagues || slices.Contains(key.LeagueIds, leagueId)
+}
+
+func scopeRank(scope string) int {
+	for i, s := range Scopes {
+		if s == scope {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// CreateAPIKey adds a key with the given scopes, limited to the given leagues
+// if there are any. It returns the key itself, which isn't stored and can't
+// be shown again.
+func CreateAPIKey(ctx context.Context, name string, scopes []string, leagueIds []string) (_ APIKey, _ string, err error) {
+	ctx, span := startSpan(ctx, "CreateAPIKey")
+	defer endSpan(span, &err)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return APIKey{}, "", invalid("name is required")
+	}
+	if len(scopes) == 0 {
+		return APIKey{}, "", invalid("a key needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if scopeRank(scope) < 0 {
+			return APIKey{}, "", invalid("scope must be one of %s", strings.Join(Scopes, ", "))
+		}
+	}
+
+	key := APIKey{
+		Id:         newId(),
+		Name:       name,
+		Scopes:     scopes,
+		AllLeagues: len(leagueIds) == 0,
+		LeagueIds:  leagueIds,
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	if key.LeagueIds == nil {
+		key.LeagueIds = make([]string, 0)
+	}
+	if key.HasScope(ScopeAdmin) && !key.AllLeagues {
+		return APIKey{}, "", invalid("admin keys can't be limited to some leagues")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", err
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(b)
+	key.Prefix = secret[:len(apiKeyPrefix)+8]
+
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		if taken, err := exists(ctx, tx, "SELECT 1 FROM api_keys WHERE name = ?", name); err != nil || taken {
+			return conflict(err, "API key", name)
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO api_keys(id, name, prefix, hash, scopes, all_leagues, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			key.Id, key.Name, key.Prefix, hashAPIKey(secret), strings.Join(key.Scopes, " "), key.AllLeagues, key.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, leagueId := range key.LeagueIds {
+			if found, err := exists(ctx, tx, "SELECT 1 FROM leagues WHERE id = ?", leagueId); err != nil || !found {
+				if err == nil {
+					err = invalid("league %s doesn't exist", leagueId)
+				}
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO api_key_leagues(key_id, league_id) VALUES (?, ?)", key.Id, leagueId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	return key, secret, nil
+}
+
+// GetAPIKeys returns every key, including revoked ones, oldest first.
+func GetAPIKeys(ctx context.Context) (_ []APIKey, err error) {
+	ctx, span := startSpan(ctx, "GetAPIKeys")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT id, name, prefix, scopes, all_leagues, created_at, revoked_at FROM api_keys ORDER BY created_at, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+
+	for rows.Next() {
+		key := APIKey{}
+		var scopes string
+		if err = rows.Scan(&key.Id, &key.Name, &key.Prefix, &scopes, &key.AllLeagues, &key.CreatedAt, &key.RevokedAt); err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+
+		if key.LeagueIds, err = apiKeyLeagues(ctx, key.Id); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey stops a key from being used. Revoked keys are kept so they
+// still show up when listing keys.
+func RevokeAPIKey(ctx context.Context, name string) (err error) {
+	ctx, span := startSpan(ctx, "RevokeAPIKey")
+	defer endSpan(span, &err)
+
+	result, err := DB.ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL",
+		time.Now().UTC().Truncate(time.Second), name)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey looks up the key a request was made with. It returns
+// ErrNotFound if the key doesn't exist or has been revoked.
+func AuthenticateAPIKey(ctx context.Context, secret string) (_ APIKey, err error) {
+	ctx, span := startSpan(ctx, "AuthenticateAPIKey")
+	defer endSpan(span, &err)
+
+	key := APIKey{}
+	var scopes string
+
+	err = apiKeyByHashStmt.QueryRowContext(ctx, hashAPIKey(secret)).
+		Scan(&key.Id, &key.Name, &key.Prefix, &scopes, &key.AllLeagues, &key.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return APIKey{}, ErrNotFound
+		}
+		return APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+
+	if key.LeagueIds, err = apiKeyLeagues(ctx, key.Id); err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// IsLeaguePrivate reports whether a league is private. Leagues that don't
+// exist aren't.
+func IsLeaguePrivate(ctx context.Context, leagueId string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "IsLeaguePrivate")
+	defer endSpan(span, &err)
+
+	var private bool
+	err = leaguePrivateStmt.QueryRowContext(ctx, leagueId).Scan(&private)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	return private, err
+}
+
+// HasPrivateLeagues reports whether any league is private.
+func HasPrivateLeagues(ctx context.Context) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "HasPrivateLeagues")
+	defer endSpan(span, &err)
+
+	var private bool
+	err = DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM leagues WHERE private)").Scan(&private)
+
+	return private, err
+}
+
+// GetRoundLeagueId returns the id of the league a round is in, or an empty
+// string if there's no such round.
+func GetRoundLeagueId(ctx context.Context, roundId string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "GetRoundLeagueId")
+	defer endSpan(span, &err)
+
+	var leagueId sql.NullString
+	err = roundLeagueStmt.QueryRowContext(ctx, roundId).Scan(&leagueId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return leagueId.String, err
+}
+
+func apiKeyLeagues(ctx context.Context, keyId string) ([]string, error) {
+	rows, err := apiKeyLeaguesStmt.QueryContext(ctx, keyId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leagueIds := make([]string, 0)
+
+	for rows.Next() {
+		var leagueId string
+		if err = rows.Scan(&leagueId); err != nil {
+			return nil, err
+		}
+		leagueIds = append(leagueIds, leagueId)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(leagueIds)
+
+	return leagueIds, nil
+}
+
+// Keys are long and random, so a plain hash is enough to keep them safe
+// without slowing down every request.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+package models
+
+import "testing"
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{"same scope", []string{ScopeWrite}, ScopeWrite, true},
+		{"admin includes read", []string{ScopeAdmin}, ScopeRead, true},
+		{"write includes read", []string{ScopeWrite}, ScopeRead, true},
+		{"read doesn't include write", []string{ScopeRead}, ScopeWrite, false},
+		{"write doesn't include admin", []string{ScopeRead, ScopeWrite}, ScopeAdmin, false},
+		{"no scopes", nil, ScopeRead, false},
+		{"unknown scope needed", []string{ScopeAdmin}, "owner", false},
+		{"unknown scope held", []string{"owner"}, ScopeRead, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := APIKey{Scopes: test.scopes}
+			if got := key.HasScope(test.scope); got != test.want {
+				t.Errorf("HasScope(%q) with scopes %v = %v, want %v", test.scope, test.scopes, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      APIKey
+		leagueId string
+		want     bool
+	}{
+		{"all leagues", APIKey{AllLeagues: true}, "a", true},
+		{"listed league", APIKey{LeagueIds: []string{"a", "b"}}, "b", true},
+		{"unlisted league", APIKey{LeagueIds: []string{"a", "b"}}, "c", false},
+		{"no leagues", APIKey{}, "a", false},
+		{"part of a league id", APIKey{LeagueIds: []string{"abc"}}, "b", false},
+		{"two league ids", APIKey{LeagueIds: []string{"a", "b"}}, "a b", false},
+		{"empty league id", APIKey{LeagueIds: []string{"a"}}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.key.CanAccess(test.leagueId); got != test.want {
+				t.Errorf("CanAccess(%q) = %v, want %v", test.leagueId, got, test.want)
+			}
+		})
+	}
+}
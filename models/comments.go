@@ -0,0 +1,287 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type CommentLeader struct {
+	Member        Member  `json:"member"`
+	Comments      int     `json:"comments"`
+	AverageLength float64 `json:"average_length"`
+	Emoji         int     `json:"emoji"`
+}
+
+type CommentedSubmission struct {
+	Round     Round  `json:"round"`
+	Submitter Member `json:"submitter"`
+	Track     Track  `json:"track"`
+	Comments  int    `json:"comments"`
+}
+
+type TermCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+type EmojiStats struct {
+	Total             int         `json:"total"`
+	CommentsWithEmoji int         `json:"comments_with_emoji"`
+	Top               []TermCount `json:"top"`
+}
+
+type CommentStats struct {
+	League        League                `json:"league"`
+	Comments      int                   `json:"comments"`
+	Leaders       []CommentLeader       `json:"leaders"`
+	MostCommented []CommentedSubmission `json:"most_commented"`
+	Words         []TermCount           `json:"words"`
+	Phrases       []TermCount           `json:"phrases"`
+	Emoji         EmojiStats            `json:"emoji"`
+}
+
+// Common English words left out of word and phrase counts.
+var stopwords = listToSet(strings.Fields(`
+	a about above after again against all am an and any are aren't as at be
+	because been before being below between both but by can can't cannot could
+	couldn't did didn't do does doesn't doing don't down during each few for
+	from further had hadn't has hasn't have haven't having he he'd he'll he's
+	her here here's hers herself him himself his how how's i i'd i'll i'm i've
+	if in into is isn't it it's its itself just let's me more most mustn't my
+	myself no nor not of off on once only or other ought our ours ourselves out
+	over own really same shan't she she'd she'll she's should shouldn't so some
+	such than that that's the their theirs them themselves then there there's
+	these they they'd they'll they're they've this those through to too under
+	until up very was wasn't we we'd we'll we're we've were weren't what what's
+	when when's where where's which while who who's whom why why's will with
+	won't would wouldn't you you'd you'll you're you've your yours yourself
+	yourselves also get got im ive dont thats its one like song songs track
+	much even still though yet
+`))
+
+// GetCommentStats analyzes the vote comments of a league: who comments most
+// and at what length, which submissions drew the most comments, the most
+// frequent words and two-word phrases, and emoji usage. Each list holds at
+// most limit entries.
+func GetCommentStats(ctx context.Context, leagueId string, limit int) (_ CommentStats, err error) {
+	ctx, span := startSpan(ctx, "GetCommentStats")
+	defer endSpan(span, &err)
+
+	league, err := GetLeagueById(ctx, leagueId)
+	if err != nil || league.Id == "" {
+		return CommentStats{}, err
+	}
+
+	stats := CommentStats{
+		League:        league,
+		Leaders:       make([]CommentLeader, 0),
+		MostCommented: make([]CommentedSubmission, 0),
+	}
+
+	rows, err := DB.QueryContext(ctx, "SELECT round_id, voter_id, recipient_id, track_id, comment FROM results WHERE league_id = ? AND comment <> ''", leagueId)
+	if err != nil {
+		return CommentStats{}, err
+	}
+	defer rows.Close()
+
+	type leaderTotals struct {
+		comments, length, emoji int
+	}
+	type submissionKey struct {
+		roundId, submitterId, trackId string
+	}
+
+	leaders := make(map[string]*leaderTotals)
+	submissions := make(map[submissionKey]int)
+	words := make(map[string]int)
+	phrases := make(map[string]int)
+	emoji := make(map[string]int)
+
+	for rows.Next() {
+		var key submissionKey
+		var voterId, comment string
+		if err = rows.Scan(&key.roundId, &voterId, &key.submitterId, &key.trackId, &comment); err != nil {
+			return CommentStats{}, err
+		}
+		comment = strings.TrimSpace(comment)
+		if comment == "" {
+			continue
+		}
+
+		stats.Comments++
+		submissions[key]++
+
+		if leaders[voterId] == nil {
+			leaders[voterId] = &leaderTotals{}
+		}
+		leaders[voterId].comments++
+		leaders[voterId].length += utf8.RuneCountInString(comment)
+
+		found := extractEmoji(comment)
+		for _, e := range found {
+			emoji[e]++
+		}
+		leaders[voterId].emoji += len(found)
+		stats.Emoji.Total += len(found)
+		if len(found) > 0 {
+			stats.Emoji.CommentsWithEmoji++
+		}
+
+		var previous string
+		for _, word := range tokenize(comment) {
+			if stopwords[word] || utf8.RuneCountInString(word) < 2 {
+				previous = ""
+				continue
+			}
+			words[word]++
+			if previous != "" && previous != word {
+				phrases[previous+" "+word]++
+			}
+			previous = word
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return CommentStats{}, err
+	}
+
+	for memberId, totals := range leaders {
+		leader := CommentLeader{
+			Comments:      totals.comments,
+			AverageLength: float64(totals.length) / float64(totals.comments),
+			Emoji:         totals.emoji,
+		}
+		if leader.Member, err = GetMemberById(ctx, memberId); err != nil {
+			return CommentStats{}, err
+		}
+		stats.Leaders = append(stats.Leaders, leader)
+	}
+
+	sort.Slice(stats.Leaders, func(i, j int) bool {
+		if stats.Leaders[i].Comments != stats.Leaders[j].Comments {
+			return stats.Leaders[i].Comments > stats.Leaders[j].Comments
+		}
+		return stats.Leaders[i].Member.Id < stats.Leaders[j].Member.Id
+	})
+	if len(stats.Leaders) > limit {
+		stats.Leaders = stats.Leaders[:limit]
+	}
+
+	keys := make([]submissionKey, 0, len(submissions))
+	for key := range submissions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if submissions[keys[i]] != submissions[keys[j]] {
+			return submissions[keys[i]] > submissions[keys[j]]
+		}
+		return keys[i].trackId < keys[j].trackId
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	for _, key := range keys {
+		submission := CommentedSubmission{Comments: submissions[key]}
+		if submission.Round, err = GetRoundById(ctx, key.roundId); err != nil {
+			return CommentStats{}, err
+		}
+		if submission.Submitter, err = GetMemberById(ctx, key.submitterId); err != nil {
+			return CommentStats{}, err
+		}
+		if submission.Track, err = GetTrackById(ctx, key.trackId); err != nil {
+			return CommentStats{}, err
+		}
+		stats.MostCommented = append(stats.MostCommented, submission)
+	}
+
+	stats.Words = topTerms(words, limit, 1)
+	stats.Phrases = topTerms(phrases, limit, 2)
+	stats.Emoji.Top = topTerms(emoji, limit, 1)
+
+	return stats, nil
+}
+
+// tokenize splits text into lowercase words, keeping apostrophes inside words
+// so contractions match the stopword list.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '’'
+	})
+
+	for i, word := range words {
+		words[i] = strings.Trim(strings.ReplaceAll(word, "’", "'"), "'")
+	}
+
+	return words
+}
+
+// extractEmoji returns the emoji in text, keeping skin tone modifiers,
+// variation selectors and zero-width-joined sequences with their base emoji.
+func extractEmoji(text string) []string {
+	found := make([]string, 0)
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		if !isEmoji(runes[i]) {
+			continue
+		}
+
+		j := i + 1
+	sequence:
+		for j < len(runes) {
+			switch {
+			case runes[j] == 0xFE0F || (runes[j] >= 0x1F3FB && runes[j] <= 0x1F3FF):
+				j++
+			case runes[j] == 0x200D && j+1 < len(runes) && isEmoji(runes[j+1]):
+				j += 2
+			default:
+				break sequence
+			}
+		}
+		found = append(found, string(runes[i:j]))
+		i = j - 1
+	}
+
+	return found
+}
+
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F300 && r <= 0x1FAFF:
+		return !(r >= 0x1F3FB && r <= 0x1F3FF)
+	case r >= 0x2600 && r <= 0x27BF:
+		return true
+	case r >= 0x1F000 && r <= 0x1F2FF:
+		return true
+	default:
+		return false
+	}
+}
+
+// topTerms returns the limit most frequent terms seen at least minCount times.
+func topTerms(counts map[string]int, limit int, minCount int) []TermCount {
+	terms := make([]TermCount, 0)
+
+	for term, count := range counts {
+		if count >= minCount {
+			terms = append(terms, TermCount{Term: term, Count: count})
+		}
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+
+	return terms
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// StartImport records that an import has started writing to the database.
+func StartImport(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "StartImport")
+	defer endSpan(span, &err)
+
+	_, err = DB.ExecContext(ctx, "INSERT INTO imports(started_at) VALUES (?)", time.Now().UTC().Truncate(time.Second))
+	return err
+}
+
+// FinishImport records that every import that was running has finished. It
+// returns ErrNotFound if none were.
+func FinishImport(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "FinishImport")
+	defer endSpan(span, &err)
+
+	result, err := DB.ExecContext(ctx, "UPDATE imports SET finished_at = ? WHERE finished_at IS NULL", time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		return err
+	}
+
+	finished, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if finished == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ImportRunning reports whether an import has started and not yet finished.
+func ImportRunning(ctx context.Context) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "ImportRunning")
+	defer endSpan(span, &err)
+
+	var running bool
+	err = DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM imports WHERE finished_at IS NULL)").Scan(&running)
+
+	return running, err
+}
+
+// LastImport returns when the last import finished, or nil if none has.
+func LastImport(ctx context.Context) (_ *time.Time, err error) {
+	ctx, span := startSpan(ctx, "LastImport")
+	defer endSpan(span, &err)
+
+	var finished time.Time
+	err = DB.QueryRowContext(ctx, "SELECT finished_at FROM imports WHERE finished_at IS NOT NULL ORDER BY finished_at DESC LIMIT 1").Scan(&finished)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &finished, nil
+}
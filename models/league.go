@@ -1,32 +1,158 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
-func ConnectDatabase() error {
-	db, err := sql.Open("sqlite3", "./music_league.db")
-	if err != nil {
+// DBConfig controls how the database is opened.
+type DBConfig struct {
+	Path string
+	// MaxOpenConns limits how many connections are open at once, or is 0 for
+	// no limit. In WAL mode SQLite lets any number of readers work alongside
+	// a single writer. Many models run queries while reading the rows of
+	// another, holding several connections at once, so a low limit can leave
+	// requests waiting on each other until their context runs out. The
+	// default leaves room for several times the connections a busy server
+	// keeps open.
+	MaxOpenConns int
+	// MaxIdleConns is how many connections are kept open between requests,
+	// along with the statements prepared on them.
+	MaxIdleConns int
+	// BusyTimeout is how long a write waits for another to finish before
+	// failing with "database is locked".
+	BusyTimeout time.Duration
+}
+
+func DefaultDBConfig() DBConfig {
+	return DBConfig{
+		Path:         "./music_league.db",
+		MaxOpenConns: 64,
+		MaxIdleConns: 16,
+		BusyTimeout:  5 * time.Second,
+	}
+}
+
+func ConnectDatabase(config DBConfig) error {
+	// Transactions take the write lock when they begin rather than when they
+	// first write, so the busy timeout applies instead of two transactions
+	// deadlocking while upgrading their locks.
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate",
+		config.Path, config.BusyTimeout.Milliseconds())
+
+	db := sql.OpenDB(observedConnector{dsn: dsn})
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return err
 	}
 
 	DB = db
-	return nil
+	return addTrackDetails()
 }
 
-type League struct {
-	Id   string `json:"id"`
-	Name string `json:"name"`
+// addTrackDetails adds the track album column and the track artists table,
+// which the models read but older imports didn't create.
+func addTrackDetails() error {
+	var found bool
+	err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pragma_table_info('track_names') WHERE name = 'album')").Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		if _, err = DB.Exec("ALTER TABLE track_names ADD COLUMN album"); err != nil {
+			return err
+		}
+	}
+
+	_, err = DB.Exec("CREATE TABLE IF NOT EXISTS track_artists(track_id, artist_id, PRIMARY KEY (track_id, artist_id))")
+	return err
 }
 
-type Round struct {
+// CloseDatabase closes the prepared statements and then the database, once
+// nothing is using them.
+func CloseDatabase() error {
+	closeStatements()
+	return DB.Close()
+}
+
+// Ping checks that the database can be reached.
+func Ping(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "Ping")
+	defer endSpan(span, &err)
+
+	return DB.PingContext(ctx)
+}
+
+type League struct {
 	Id         string `json:"id"`
 	Name       string `json:"name"`
-	TotalVotes int    `json:"total_votes"`
+	VoteBudget *int   `json:"vote_budget,omitempty"`
+	Private    bool   `json:"private"`
+}
+
+type LeagueSummary struct {
+	League
+	Stats LeagueStats `json:"stats"`
+}
+
+type LeagueStats struct {
+	MemberCount     int `json:"member_count"`
+	RoundCount      int `json:"round_count"`
+	SubmissionCount int `json:"submission_count"`
+	PointsAwarded   int `json:"points_awarded"`
+	// Champions are the members with the most points, all of them if tied.
+	Champions           []Standing   `json:"champions,omitempty"`
+	MostSubmittedArtist *ArtistCount `json:"most_submitted_artist,omitempty"`
+	ClosestRound        *RoundMargin `json:"closest_round,omitempty"`
+	BiggestBlowout      *RoundMargin `json:"biggest_blowout,omitempty"`
+	// StartedAt is when the league's first round was created and EndedAt when
+	// its last one was completed, or created if it hasn't been. Rounds from
+	// imports have neither.
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+type Standing struct {
+	Member Member `json:"member"`
+	Points int    `json:"points"`
+}
+
+type ArtistCount struct {
+	Artist      Artist `json:"artist"`
+	Submissions int    `json:"submissions"`
+}
+
+type RoundMargin struct {
+	Round    Round  `json:"round"`
+	Winner   Member `json:"winner"`
+	RunnerUp Member `json:"runner_up"`
+	Margin   int    `json:"margin"`
+}
+
+type Round struct {
+	Id                string     `json:"id"`
+	Name              string     `json:"name"`
+	TotalVotes        int        `json:"total_votes"`
+	League            *League    `json:"league,omitempty"`
+	Sequence          int        `json:"sequence"`
+	Description       string     `json:"description,omitempty"`
+	SubmissionCount   int        `json:"submission_count"`
+	VoterCount        int        `json:"voter_count"`
+	ParticipationRate float64    `json:"participation_rate"`
+	Winners           []Member   `json:"winners,omitempty"`
+	CreatedAt         *time.Time `json:"created_at,omitempty"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
 }
 
 type Member struct {
@@ -45,12 +171,13 @@ type Track struct {
 }
 
 type Vote struct {
-	Voter     Member `json:"voter"`
-	Votes     int    `json:"votes"`
-	Comment   string `json:"comment"`
-	Track     Track  `json:"track"`
-	Round     Round  `json:"round"`
-	Placement int    `json:"placement"`
+	Voter      Member           `json:"voter"`
+	Votes      int              `json:"votes"`
+	Comment    string           `json:"comment"`
+	Track      Track            `json:"track"`
+	Round      Round            `json:"round"`
+	Placement  int              `json:"placement"`
+	Normalized *NormalizedScore `json:"normalized,omitempty"`
 }
 
 type Submission struct {
@@ -66,10 +193,11 @@ type VotesGiven struct {
 }
 
 type Placement struct {
-	Member    Member `json:"member"`
-	Votes     int    `json:"votes"`
-	Placement int    `json:"placement"`
-	Round     Round  `json:"round"`
+	Member     Member           `json:"member"`
+	Votes      int              `json:"votes"`
+	Placement  int              `json:"placement"`
+	Round      Round            `json:"round"`
+	Normalized *NormalizedScore `json:"normalized,omitempty"`
 }
 
 type Artist struct {
@@ -79,8 +207,11 @@ type Artist struct {
 	Followers  int    `json:"followers"`
 }
 
-func GetLeagues() ([]League, error) {
-	rows, err := DB.Query("SELECT id, name FROM leagues")
+func GetLeagues(ctx context.Context) (_ []League, err error) {
+	ctx, span := startSpan(ctx, "GetLeagues")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT id, name, vote_budget, private FROM leagues")
 
 	if err != nil {
 		return nil, err
@@ -92,7 +223,7 @@ func GetLeagues() ([]League, error) {
 
 	for rows.Next() {
 		league := League{}
-		err = rows.Scan(&league.Id, &league.Name)
+		err = rows.Scan(&league.Id, &league.Name, &league.VoteBudget, &league.Private)
 
 		if err != nil {
 			return nil, err
@@ -110,15 +241,13 @@ func GetLeagues() ([]League, error) {
 	return leagues, err
 }
 
-func GetLeagueById(id string) (League, error) {
-	stmt, err := DB.Prepare("SELECT id, name FROM leagues WHERE id = ?")
-	if err != nil {
-		return League{}, err
-	}
+func GetLeagueById(ctx context.Context, id string) (_ League, err error) {
+	ctx, span := startSpan(ctx, "GetLeagueById")
+	defer endSpan(span, &err)
 
 	league := League{}
 
-	sqlErr := stmt.QueryRow(id).Scan(&league.Id, &league.Name)
+	sqlErr := leagueByIdStmt.QueryRowContext(ctx, id).Scan(&league.Id, &league.Name, &league.VoteBudget, &league.Private)
 	if sqlErr != nil {
 		if sqlErr == sql.ErrNoRows {
 			return League{}, nil
@@ -129,8 +258,157 @@ func GetLeagueById(id string) (League, error) {
 	return league, nil
 }
 
-func GetRounds(leagueId string) ([]Round, error) {
-	rows, err := DB.Query("SELECT round_id, name, SUM(votes) FROM results JOIN rounds ON results.round_id = rounds.id WHERE league_id = ? GROUP BY round_id ORDER BY sequence", leagueId)
+// GetLeagueSummary returns a league along with summary stats across all of
+// its rounds.
+func GetLeagueSummary(ctx context.Context, leagueId string) (_ LeagueSummary, err error) {
+	ctx, span := startSpan(ctx, "GetLeagueSummary")
+	defer endSpan(span, &err)
+
+	league, err := GetLeagueById(ctx, leagueId)
+	if err != nil || league.Id == "" {
+		return LeagueSummary{}, err
+	}
+
+	summary := LeagueSummary{League: league}
+	stats := &summary.Stats
+
+	err = DB.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM league_members WHERE league_id = ?),
+		(SELECT COUNT(*) FROM rounds WHERE league_id = ?),
+		(SELECT COUNT(*) FROM submissions WHERE league_id = ?),
+		(SELECT COALESCE(SUM(votes), 0) FROM results WHERE league_id = ?)`,
+		leagueId, leagueId, leagueId, leagueId).Scan(&stats.MemberCount, &stats.RoundCount, &stats.SubmissionCount, &stats.PointsAwarded)
+	if err != nil {
+		return LeagueSummary{}, err
+	}
+
+	// Aggregates have no declared type, so the driver returns the times as text.
+	var startedAt, endedAt sql.NullString
+	err = DB.QueryRowContext(ctx, "SELECT MIN(created_at), MAX(COALESCE(completed_at, created_at)) FROM rounds WHERE league_id = ?", leagueId).Scan(&startedAt, &endedAt)
+	if err != nil {
+		return LeagueSummary{}, err
+	}
+	stats.StartedAt, stats.EndedAt = parseTimestamp(startedAt), parseTimestamp(endedAt)
+
+	if stats.Champions, err = getLeagueChampions(ctx, leagueId); err != nil {
+		return LeagueSummary{}, err
+	}
+
+	var artistId string
+	var artistSubmissions int
+	err = DB.QueryRowContext(ctx, `SELECT artist_id, COUNT(*) FROM submissions JOIN track_artists ON submissions.track_id = track_artists.track_id
+		WHERE league_id = ? GROUP BY artist_id ORDER BY COUNT(*) DESC, artist_id LIMIT 1`, leagueId).Scan(&artistId, &artistSubmissions)
+	if err != nil && err != sql.ErrNoRows {
+		return LeagueSummary{}, err
+	}
+	if artistId != "" {
+		stats.MostSubmittedArtist = &ArtistCount{Submissions: artistSubmissions}
+		err = DB.QueryRowContext(ctx, "SELECT id, name, popularity, followers FROM artist WHERE id = ?", artistId).Scan(
+			&stats.MostSubmittedArtist.Artist.Id, &stats.MostSubmittedArtist.Artist.Name,
+			&stats.MostSubmittedArtist.Artist.Popularity, &stats.MostSubmittedArtist.Artist.Followers)
+		if err != nil {
+			return LeagueSummary{}, err
+		}
+	}
+
+	results, err := GetLeagueRoundResults(ctx, leagueId)
+	if err != nil {
+		return LeagueSummary{}, err
+	}
+
+	for _, result := range results {
+		ranking := result.Ranking()
+		if len(ranking) < 2 || result.Points[ranking[0]] == 0 {
+			continue
+		}
+
+		margin := result.Points[ranking[0]] - result.Points[ranking[1]]
+		if stats.ClosestRound == nil || margin < stats.ClosestRound.Margin {
+			if stats.ClosestRound, err = getRoundMargin(ctx, result.RoundId, ranking, margin); err != nil {
+				return LeagueSummary{}, err
+			}
+		}
+		if stats.BiggestBlowout == nil || margin > stats.BiggestBlowout.Margin {
+			if stats.BiggestBlowout, err = getRoundMargin(ctx, result.RoundId, ranking, margin); err != nil {
+				return LeagueSummary{}, err
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// getLeagueChampions returns every member tied for the most points in a
+// league, as getRoundWinnersById does for a round.
+func getLeagueChampions(ctx context.Context, leagueId string) ([]Standing, error) {
+	rows, err := DB.QueryContext(ctx, `SELECT recipient_id, SUM(votes) FROM results WHERE league_id = ? GROUP BY recipient_id
+		HAVING SUM(votes) = (SELECT MAX(points) FROM (SELECT SUM(votes) AS points FROM results WHERE league_id = ? GROUP BY recipient_id))
+		ORDER BY recipient_id`, leagueId, leagueId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	champions := make([]Standing, 0)
+	for rows.Next() {
+		var champion Standing
+		if err = rows.Scan(&champion.Member.Id, &champion.Points); err != nil {
+			return nil, err
+		}
+		champions = append(champions, champion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range champions {
+		if champions[i].Member, err = GetMemberById(ctx, champions[i].Member.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	return champions, nil
+}
+
+// parseTimestamp reads a time the driver returned as text, the way it reads
+// TIMESTAMP columns.
+func parseTimestamp(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+
+	text := strings.TrimSuffix(value.String, "Z")
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(format, text, time.UTC); err == nil {
+			return &t
+		}
+	}
+
+	return nil
+}
+
+func getRoundMargin(ctx context.Context, roundId string, ranking []string, margin int) (*RoundMargin, error) {
+	roundMargin := &RoundMargin{Margin: margin}
+
+	var err error
+	if roundMargin.Round, err = GetRoundById(ctx, roundId); err != nil {
+		return nil, err
+	}
+	if roundMargin.Winner, err = GetMemberById(ctx, ranking[0]); err != nil {
+		return nil, err
+	}
+	if roundMargin.RunnerUp, err = GetMemberById(ctx, ranking[1]); err != nil {
+		return nil, err
+	}
+
+	return roundMargin, nil
+}
+
+func GetRounds(ctx context.Context, leagueId string) (_ []Round, err error) {
+	ctx, span := startSpan(ctx, "GetRounds")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT id FROM rounds WHERE league_id = ? ORDER BY sequence", leagueId)
 
 	if err != nil {
 		return nil, err
@@ -138,17 +416,17 @@ func GetRounds(leagueId string) ([]Round, error) {
 
 	defer rows.Close()
 
-	rounds := make([]Round, 0)
+	roundIds := make([]string, 0)
 
 	for rows.Next() {
-		round := Round{}
-		err = rows.Scan(&round.Id, &round.Name, &round.TotalVotes)
+		var roundId string
+		err = rows.Scan(&roundId)
 
 		if err != nil {
 			return nil, err
 		}
 
-		rounds = append(rounds, round)
+		roundIds = append(roundIds, roundId)
 	}
 
 	err = rows.Err()
@@ -157,11 +435,25 @@ func GetRounds(leagueId string) ([]Round, error) {
 		return nil, err
 	}
 
-	return rounds, err
+	rounds := make([]Round, 0)
+
+	for _, roundId := range roundIds {
+		round, err := GetRoundById(ctx, roundId)
+		if err != nil {
+			return nil, err
+		}
+
+		rounds = append(rounds, round)
+	}
+
+	return rounds, nil
 }
 
-func GetAllMembers() ([]Member, error) {
-	rows, err := DB.Query("SELECT id, name, picture FROM members")
+func GetAllMembers(ctx context.Context) (_ []Member, err error) {
+	ctx, span := startSpan(ctx, "GetAllMembers")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT id, name, picture FROM members")
 	if err != nil {
 		return nil, err
 	}
@@ -186,8 +478,11 @@ func GetAllMembers() ([]Member, error) {
 	return members, err
 }
 
-func GetRoundMembers(roundId string) ([]Member, error) {
-	rows, err := DB.Query("SELECT id, name, picture FROM members WHERE id IN (SELECT DISTINCT recipient_id FROM results WHERE round_id = ?)", roundId)
+func GetRoundMembers(ctx context.Context, roundId string) (_ []Member, err error) {
+	ctx, span := startSpan(ctx, "GetRoundMembers")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT id, name, picture FROM members WHERE id IN (SELECT DISTINCT recipient_id FROM results WHERE round_id = ?)", roundId)
 	if err != nil {
 		return nil, err
 	}
@@ -212,8 +507,11 @@ func GetRoundMembers(roundId string) ([]Member, error) {
 	return members, err
 }
 
-func GetMembers(leagueId string) ([]Member, error) {
-	rows, err := DB.Query("SELECT id, name, picture FROM members WHERE id IN (SELECT DISTINCT recipient_id FROM results WHERE league_id = ?)", leagueId)
+func GetMembers(ctx context.Context, leagueId string) (_ []Member, err error) {
+	ctx, span := startSpan(ctx, "GetMembers")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT id, name, picture FROM members WHERE id IN (SELECT member_id FROM league_members WHERE league_id = ?)", leagueId)
 	if err != nil {
 		return nil, err
 	}
@@ -238,8 +536,11 @@ func GetMembers(leagueId string) ([]Member, error) {
 	return members, err
 }
 
-func GetVotesReceived(leagueId string, memberId string) ([]Vote, error) {
-	rows, err := DB.Query("SELECT voter_id, SUM(votes) FROM results WHERE league_id = ? AND recipient_id = ? GROUP BY voter_id ORDER BY SUM(votes) DESC", leagueId, memberId)
+func GetVotesReceived(ctx context.Context, leagueId string, memberId string) (_ []Vote, err error) {
+	ctx, span := startSpan(ctx, "GetVotesReceived")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT voter_id, SUM(votes) FROM results WHERE league_id = ? AND recipient_id = ? GROUP BY voter_id ORDER BY SUM(votes) DESC", leagueId, memberId)
 	if err != nil {
 		return nil, err
 	}
@@ -254,7 +555,7 @@ func GetVotesReceived(leagueId string, memberId string) ([]Vote, error) {
 		if err = rows.Scan(&voterId, &vote.Votes); err != nil {
 			return nil, err
 		}
-		if vote.Voter, err = GetMemberById(voterId); err != nil {
+		if vote.Voter, err = GetMemberById(ctx, voterId); err != nil {
 			return nil, err
 		}
 
@@ -268,8 +569,11 @@ func GetVotesReceived(leagueId string, memberId string) ([]Vote, error) {
 	return votes, err
 }
 
-func GetVotesGiven(leagueId string, memberId string) ([]Vote, error) {
-	rows, err := DB.Query("SELECT recipient_id, SUM(votes) FROM results WHERE league_id = ? AND voter_id = ? GROUP BY recipient_id ORDER BY SUM(votes) DESC", leagueId, memberId)
+func GetVotesGiven(ctx context.Context, leagueId string, memberId string) (_ []Vote, err error) {
+	ctx, span := startSpan(ctx, "GetVotesGiven")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT recipient_id, SUM(votes) FROM results WHERE league_id = ? AND voter_id = ? GROUP BY recipient_id ORDER BY SUM(votes) DESC", leagueId, memberId)
 	if err != nil {
 		return nil, err
 	}
@@ -284,7 +588,7 @@ func GetVotesGiven(leagueId string, memberId string) ([]Vote, error) {
 		if err = rows.Scan(&voterId, &vote.Votes); err != nil {
 			return nil, err
 		}
-		if vote.Voter, err = GetMemberById(voterId); err != nil {
+		if vote.Voter, err = GetMemberById(ctx, voterId); err != nil {
 			return nil, err
 		}
 
@@ -298,8 +602,11 @@ func GetVotesGiven(leagueId string, memberId string) ([]Vote, error) {
 	return votes, err
 }
 
-func GetRoundStandings(leagueId string, memberId string) ([]Vote, error) {
-	rows, err := DB.Query("SELECT round_id, SUM(votes) FROM results JOIN rounds ON results.round_id = rounds.id WHERE league_id = ? AND recipient_id = ? GROUP BY round_id ORDER BY sequence", leagueId, memberId)
+func GetRoundStandings(ctx context.Context, leagueId string, memberId string) (_ []Vote, err error) {
+	ctx, span := startSpan(ctx, "GetRoundStandings")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT round_id, SUM(votes) FROM results JOIN rounds ON results.round_id = rounds.id WHERE results.league_id = ? AND recipient_id = ? GROUP BY round_id ORDER BY sequence", leagueId, memberId)
 	if err != nil {
 		return nil, err
 	}
@@ -308,7 +615,12 @@ func GetRoundStandings(leagueId string, memberId string) ([]Vote, error) {
 
 	votes := make([]Vote, 0)
 
-	member, err := GetMemberById(memberId)
+	member, err := GetMemberById(ctx, memberId)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := GetLeagueRoundResults(ctx, leagueId)
 	if err != nil {
 		return nil, err
 	}
@@ -321,11 +633,24 @@ func GetRoundStandings(leagueId string, memberId string) ([]Vote, error) {
 		if err = rows.Scan(&roundId, &vote.Votes); err != nil {
 			return nil, err
 		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
 
-		if vote.Round, err = GetRoundById(roundId); err != nil {
+		if vote.Round, err = GetRoundById(ctx, roundId); err != nil {
 			return nil, err
 		}
 
+		for _, result := range results {
+			if result.RoundId != roundId {
+				continue
+			}
+
+			score := result.Normalized()[memberId]
+			vote.Normalized = &score
+			vote.Placement = result.Placements()[memberId]
+		}
+
 		votes = append(votes, vote)
 	}
 
@@ -336,45 +661,49 @@ func GetRoundStandings(leagueId string, memberId string) ([]Vote, error) {
 	return votes, err
 }
 
-func GetRoundRankings(roundId string) ([]Placement, error) {
-	rows, err := DB.Query("SELECT id, SUM(votes) FROM results JOIN members ON results.recipient_id = members.id WHERE round_id = ? GROUP BY recipient_id ORDER BY SUM(votes) DESC", roundId)
+// GetRoundRankings returns every submitter in a round with their points and
+// placement, highest first.
+func GetRoundRankings(ctx context.Context, roundId string) (_ []Placement, err error) {
+	ctx, span := startSpan(ctx, "GetRoundRankings")
+	defer endSpan(span, &err)
+
+	round, err := GetRoundById(ctx, roundId)
+	if err != nil || round.Id == "" {
+		return nil, err
+	}
+
+	result, err := GetRoundResult(ctx, roundId)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	placements := result.Placements()
+	scores := result.Normalized()
 
-	ranking := make([]Placement, 0)
-	var rank = 1
-	for rows.Next() {
-		placement := Placement{}
-		var memberId string
-		if err = rows.Scan(&memberId, &placement.Votes); err != nil {
-			return nil, err
+	ranking := make([]Placement, 0, len(result.Points))
+	for _, memberId := range result.Ranking() {
+		placement := Placement{
+			Votes:     result.Points[memberId],
+			Placement: placements[memberId],
+			Round:     round,
 		}
-		if placement.Member, err = GetMemberById(memberId); err != nil {
+		if placement.Member, err = GetMemberById(ctx, memberId); err != nil {
 			return nil, err
 		}
-		if placement.Round, err = GetRoundById(roundId); err != nil {
-			return nil, err
-		}
-		placement.Placement = rank
+		score := scores[memberId]
+		placement.Normalized = &score
 
 		ranking = append(ranking, placement)
-		rank += 1
-	}
-
-	err = rows.Err()
-
-	if err != nil {
-		return nil, err
 	}
 
-	return ranking, err
+	return ranking, nil
 }
 
-func GetFavoriteSongs(leagueId string, memberId string) ([]Vote, error) {
-	rows, err := DB.Query("SELECT track_id, name, album, picture, votes, comment, recipient_id FROM results JOIN track_names ON results.track_id = track_names.id WHERE voter_id = ? AND league_id = ? ORDER BY votes DESC", memberId, leagueId)
+func GetFavoriteSongs(ctx context.Context, leagueId string, memberId string) (_ []Vote, err error) {
+	ctx, span := startSpan(ctx, "GetFavoriteSongs")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT track_id, name, COALESCE(album, ''), picture, votes, comment, recipient_id FROM results JOIN track_names ON results.track_id = track_names.id WHERE voter_id = ? AND league_id = ? ORDER BY votes DESC", memberId, leagueId)
 	if err != nil {
 		return nil, err
 	}
@@ -383,7 +712,7 @@ func GetFavoriteSongs(leagueId string, memberId string) ([]Vote, error) {
 
 	votes := make([]Vote, 0)
 
-	member, err := GetMemberById(memberId)
+	member, err := GetMemberById(ctx, memberId)
 	if err != nil {
 		return nil, err
 	}
@@ -396,11 +725,11 @@ func GetFavoriteSongs(leagueId string, memberId string) ([]Vote, error) {
 		if err = rows.Scan(&vote.Track.Id, &vote.Track.Name, &vote.Track.Album, &vote.Track.Picture, &vote.Votes, &vote.Comment, &submitterId); err != nil {
 			return nil, err
 		}
-		if vote.Track.Submitter, err = GetMemberById(submitterId); err != nil {
+		if vote.Track.Submitter, err = GetMemberById(ctx, submitterId); err != nil {
 			return nil, err
 		}
 
-		if vote.Track.Artists, err = GetTrackArtists(vote.Track.Id); err != nil {
+		if vote.Track.Artists, err = GetTrackArtists(ctx, vote.Track.Id); err != nil {
 			return nil, err
 		}
 
@@ -414,8 +743,11 @@ func GetFavoriteSongs(leagueId string, memberId string) ([]Vote, error) {
 	return votes, err
 }
 
-func GetSubmissions(roundId string) ([]Submission, error) {
-	rows, err := DB.Query("SELECT submitter_id, track_id, name, album, picture, comment FROM submissions JOIN track_names ON track_id = track_names.id WHERE round_id = ?", roundId)
+func GetSubmissions(ctx context.Context, roundId string) (_ []Submission, err error) {
+	ctx, span := startSpan(ctx, "GetSubmissions")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT submitter_id, track_id, name, COALESCE(album, ''), picture, comment FROM submissions JOIN track_names ON track_id = track_names.id WHERE round_id = ?", roundId)
 	if err != nil {
 		return nil, err
 	}
@@ -431,21 +763,20 @@ func GetSubmissions(roundId string) ([]Submission, error) {
 		if err = rows.Scan(&submitterId, &track.Id, &track.Name, &track.Album, &track.Picture, &submission.Comment); err != nil {
 			return nil, err
 		}
-		submission.Track = track
-		if submission.Submitter, err = GetMemberById(submitterId); err != nil {
+		if submission.Submitter, err = GetMemberById(ctx, submitterId); err != nil {
 			return nil, err
 		}
-		submission.Track = track
 
-		votes, err := GetVotesBySubmission(roundId, submitterId)
+		votes, err := GetVotesBySubmission(ctx, roundId, submitterId)
 		if err != nil {
 			return nil, err
 		}
 
-		if track.Artists, err = GetTrackArtists(track.Id); err != nil {
+		if track.Artists, err = GetTrackArtists(ctx, track.Id); err != nil {
 			return nil, err
 		}
 
+		submission.Track = track
 		submission.Votes = votes
 		submissions = append(submissions, submission)
 	}
@@ -459,8 +790,11 @@ func GetSubmissions(roundId string) ([]Submission, error) {
 	return submissions, err
 }
 
-func GetVotesBySubmission(roundId string, submitterId string) ([]Vote, error) {
-	rows, err := DB.Query("SELECT voter_id, votes, track_id, name, album, picture, comment FROM results JOIN track_names ON track_id = id WHERE round_id = ? AND recipient_id = ?", roundId, submitterId)
+func GetVotesBySubmission(ctx context.Context, roundId string, submitterId string) (_ []Vote, err error) {
+	ctx, span := startSpan(ctx, "GetVotesBySubmission")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT voter_id, votes, track_id, name, COALESCE(album, ''), picture, comment FROM results JOIN track_names ON track_id = id WHERE round_id = ? AND recipient_id = ?", roundId, submitterId)
 	if err != nil {
 		return nil, err
 	}
@@ -475,11 +809,11 @@ func GetVotesBySubmission(roundId string, submitterId string) ([]Vote, error) {
 		if err = rows.Scan(&voterId, &vote.Votes, &vote.Track.Id, &vote.Track.Name, &vote.Track.Album, &vote.Track.Picture, &vote.Comment); err != nil {
 			return nil, err
 		}
-		if vote.Voter, err = GetMemberById(voterId); err != nil {
+		if vote.Voter, err = GetMemberById(ctx, voterId); err != nil {
 			return nil, err
 		}
 
-		if vote.Track.Artists, err = GetTrackArtists(vote.Track.Id); err != nil {
+		if vote.Track.Artists, err = GetTrackArtists(ctx, vote.Track.Id); err != nil {
 			return nil, err
 		}
 
@@ -493,8 +827,11 @@ func GetVotesBySubmission(roundId string, submitterId string) ([]Vote, error) {
 	return votes, err
 }
 
-func GetVotesByRound(roundId string) ([]Vote, error) {
-	rows, err := DB.Query("SELECT voter_id, votes, track_id, name, album, picture, comment FROM results JOIN track_names ON track_id = id WHERE round_id = ?", roundId)
+func GetVotesByRound(ctx context.Context, roundId string) (_ []Vote, err error) {
+	ctx, span := startSpan(ctx, "GetVotesByRound")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT voter_id, votes, track_id, name, COALESCE(album, ''), picture, comment FROM results JOIN track_names ON track_id = id WHERE round_id = ?", roundId)
 	if err != nil {
 		return nil, err
 	}
@@ -509,11 +846,11 @@ func GetVotesByRound(roundId string) ([]Vote, error) {
 		if err = rows.Scan(&voterId, &vote.Votes, &vote.Track.Id, &vote.Track.Name, &vote.Track.Album, &vote.Track.Picture, &vote.Comment); err != nil {
 			return nil, err
 		}
-		if vote.Voter, err = GetMemberById(voterId); err != nil {
+		if vote.Voter, err = GetMemberById(ctx, voterId); err != nil {
 			return nil, err
 		}
 
-		if vote.Track.Artists, err = GetTrackArtists(vote.Track.Id); err != nil {
+		if vote.Track.Artists, err = GetTrackArtists(ctx, vote.Track.Id); err != nil {
 			return nil, err
 		}
 
@@ -527,8 +864,11 @@ func GetVotesByRound(roundId string) ([]Vote, error) {
 	return votes, err
 }
 
-func GetVotesByVoter(roundId string) ([]VotesGiven, error) {
-	rows, err := DB.Query("SELECT voter_id, recipient_id, votes, track_id, name, album, picture, comment FROM results JOIN track_names ON track_id = track_names.id WHERE round_id = ?", roundId)
+func GetVotesByVoter(ctx context.Context, roundId string) (_ []VotesGiven, err error) {
+	ctx, span := startSpan(ctx, "GetVotesByVoter")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, "SELECT voter_id, recipient_id, votes, track_id, name, COALESCE(album, ''), picture, comment FROM results JOIN track_names ON track_id = track_names.id WHERE round_id = ?", roundId)
 	if err != nil {
 		return nil, err
 	}
@@ -546,15 +886,15 @@ func GetVotesByVoter(roundId string) ([]VotesGiven, error) {
 			return nil, err
 		}
 
-		if track.Artists, err = GetTrackArtists(track.Id); err != nil {
+		if track.Artists, err = GetTrackArtists(ctx, track.Id); err != nil {
 			return nil, err
 		}
 
 		vote.Track = track
-		if track.Submitter, err = GetMemberById(submitterId); err != nil {
+		if track.Submitter, err = GetMemberById(ctx, submitterId); err != nil {
 			return nil, err
 		}
-		if votesGiven.Voter, err = GetMemberById(voterId); err != nil {
+		if votesGiven.Voter, err = GetMemberById(ctx, voterId); err != nil {
 			return nil, err
 		}
 		vote.Voter = votesGiven.Voter
@@ -583,15 +923,13 @@ func GetVotesByVoter(roundId string) ([]VotesGiven, error) {
 
 }
 
-func GetMemberById(memberId string) (Member, error) {
-	stmt, err := DB.Prepare("SELECT id, name, picture FROM members WHERE id = ?")
-	if err != nil {
-		return Member{}, err
-	}
+func GetMemberById(ctx context.Context, memberId string) (_ Member, err error) {
+	ctx, span := startSpan(ctx, "GetMemberById")
+	defer endSpan(span, &err)
 
 	member := Member{}
 
-	sqlErr := stmt.QueryRow(memberId).Scan(&member.Id, &member.Name, &member.Picture)
+	sqlErr := memberByIdStmt.QueryRowContext(ctx, memberId).Scan(&member.Id, &member.Name, &member.Picture)
 	if sqlErr != nil {
 		if sqlErr == sql.ErrNoRows {
 			return Member{}, nil
@@ -602,14 +940,16 @@ func GetMemberById(memberId string) (Member, error) {
 	return member, nil
 }
 
-func GetRoundById(roundId string) (Round, error) {
-	stmt, err := DB.Prepare("SELECT round_id, name, SUM(votes) FROM results JOIN rounds ON results.round_id = rounds.id WHERE round_id = ? ORDER BY sequence")
-	if err != nil {
-		return Round{}, err
-	}
+func GetRoundById(ctx context.Context, roundId string) (_ Round, err error) {
+	ctx, span := startSpan(ctx, "GetRoundById")
+	defer endSpan(span, &err)
 
 	round := Round{}
-	err = stmt.QueryRow(roundId).Scan(&round.Id, &round.Name, &round.TotalVotes)
+	var leagueId string
+	var createdAt, completedAt sql.NullTime
+	var submitters int
+	err = roundByIdStmt.QueryRowContext(ctx, roundId).Scan(&round.Id, &round.Name, &round.Sequence, &round.Description, &leagueId, &createdAt, &completedAt,
+		&round.TotalVotes, &round.SubmissionCount, &submitters, &round.VoterCount)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Round{}, nil
@@ -617,51 +957,119 @@ func GetRoundById(roundId string) (Round, error) {
 		return Round{}, err
 	}
 
+	if createdAt.Valid {
+		round.CreatedAt = &createdAt.Time
+	}
+	if completedAt.Valid {
+		round.CompletedAt = &completedAt.Time
+	}
+	if submitters > 0 {
+		round.ParticipationRate = float64(round.VoterCount) / float64(submitters)
+	}
+
+	if leagueId != "" {
+		league, err := GetLeagueById(ctx, leagueId)
+		if err != nil {
+			return Round{}, err
+		}
+		round.League = &league
+	}
+
+	if round.VoterCount > 0 {
+		if round.Winners, err = getRoundWinnersById(ctx, roundId); err != nil {
+			return Round{}, err
+		}
+	}
+
 	return round, nil
 }
 
-func GetSimilarity(roundId string, memberId string) (map[string]float32, error) {
-	similarities := make(map[string]float32)
-	votes := make(map[string][]string)
-
-	rows, err := DB.Query("SELECT voter_id, track_id FROM results WHERE round_id = ? AND votes > 0 UNION SELECT submitter_id, track_id FROM submissions WHERE round_id = ?", roundId, roundId)
+// getRoundWinnersById returns the members with the most points in a round,
+// like getRoundWinners. Tied rounds have more than one winner.
+func getRoundWinnersById(ctx context.Context, roundId string) ([]Member, error) {
+	rows, err := roundWinnersStmt.QueryContext(ctx, roundId, roundId)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	winnerIds := make([]string, 0)
+
 	for rows.Next() {
-		var voterId, trackId string
-		if err = rows.Scan(&voterId, &trackId); err != nil {
+		var memberId string
+		if err = rows.Scan(&memberId); err != nil {
 			return nil, err
 		}
-
-		votes[voterId] = append(votes[voterId], trackId)
+		winnerIds = append(winnerIds, memberId)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	memberVotes := listToSet(votes[memberId])
+	winners := make([]Member, 0, len(winnerIds))
+	for _, memberId := range winnerIds {
+		winner, err := GetMemberById(ctx, memberId)
+		if err != nil {
+			return nil, err
+		}
+		winners = append(winners, winner)
+	}
 
-	for voterId, votes := range votes {
-		if voterId == memberId {
-			continue // Don't calculate similarity with yourself
+	return winners, nil
+}
+
+func GetTrackById(ctx context.Context, trackId string) (_ Track, err error) {
+	ctx, span := startSpan(ctx, "GetTrackById")
+	defer endSpan(span, &err)
+
+	track := Track{}
+	err = trackByIdStmt.QueryRowContext(ctx, trackId).Scan(&track.Id, &track.Name, &track.Album, &track.Picture)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Track{}, nil
 		}
+		return Track{}, err
+	}
 
-		otherVotes := listToSet(votes)
-		similarities[voterId] = calculateJaccardSimilarity(memberVotes, otherVotes)
+	if track.Artists, err = GetTrackArtists(ctx, track.Id); err != nil {
+		return Track{}, err
 	}
 
-	return similarities, nil
+	return track, nil
 }
 
-func GetLeagueSimilarity(leagueId string, memberId string) (map[string]float32, error) {
-	similarities := make(map[string]float32)
+func GetSimilarity(ctx context.Context, roundId string, memberId string) (_ map[string]float32, err error) {
+	ctx, span := startSpan(ctx, "GetSimilarity")
+	defer endSpan(span, &err)
+
+	votes, err := getLikedTracks(ctx, "round_id", roundId)
+	if err != nil {
+		return nil, err
+	}
+
+	return similaritiesTo(votes, memberId), nil
+}
+
+func GetLeagueSimilarity(ctx context.Context, leagueId string, memberId string) (_ map[string]float32, err error) {
+	ctx, span := startSpan(ctx, "GetLeagueSimilarity")
+	defer endSpan(span, &err)
+
+	votes, err := getLikedTracks(ctx, "league_id", leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	return similaritiesTo(votes, memberId), nil
+}
+
+// getLikedTracks returns the tracks each member gave points to or submitted
+// in a round or league, where column is round_id or league_id. Votes are
+// stored as text, so they're cast before comparing, or downvotes would count.
+func getLikedTracks(ctx context.Context, column string, id string) (map[string][]string, error) {
 	votes := make(map[string][]string)
 
-	rows, err := DB.Query("SELECT voter_id, track_id FROM results WHERE league_id = ? AND votes > 0 UNION SELECT submitter_id, track_id FROM submissions WHERE league_id = ?", leagueId, leagueId)
+	rows, err := DB.QueryContext(ctx, "SELECT voter_id, track_id FROM results WHERE "+column+" = ? AND CAST(votes AS INTEGER) > 0 UNION SELECT submitter_id, track_id FROM submissions WHERE "+column+" = ?", id, id)
 	if err != nil {
 		return nil, err
 	}
@@ -676,10 +1084,13 @@ func GetLeagueSimilarity(leagueId string, memberId string) (map[string]float32,
 		votes[voterId] = append(votes[voterId], trackId)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+	return votes, rows.Err()
+}
 
+// similaritiesTo returns how similar each other member's tracks are to
+// memberId's.
+func similaritiesTo(votes map[string][]string, memberId string) map[string]float32 {
+	similarities := make(map[string]float32)
 	memberVotes := listToSet(votes[memberId])
 
 	for voterId, votes := range votes {
@@ -691,7 +1102,56 @@ func GetLeagueSimilarity(leagueId string, memberId string) (map[string]float32,
 		similarities[voterId] = calculateJaccardSimilarity(memberVotes, otherVotes)
 	}
 
-	return similarities, nil
+	return similarities
+}
+
+type SimilarityMatrix struct {
+	Members []Member    `json:"members"`
+	Values  [][]float32 `json:"values"`
+}
+
+// GetLeagueSimilarityMatrix returns the voting similarity of every pair of
+// members in a league. Values[i][j] is the similarity of Members[i] and
+// Members[j], and is 1 on the diagonal.
+func GetLeagueSimilarityMatrix(ctx context.Context, leagueId string) (_ SimilarityMatrix, err error) {
+	ctx, span := startSpan(ctx, "GetLeagueSimilarityMatrix")
+	defer endSpan(span, &err)
+
+	members, err := GetMembers(ctx, leagueId)
+	if err != nil {
+		return SimilarityMatrix{}, err
+	}
+
+	votes, err := getLikedTracks(ctx, "league_id", leagueId)
+	if err != nil {
+		return SimilarityMatrix{}, err
+	}
+
+	matrix := SimilarityMatrix{
+		Members: members,
+		Values:  make([][]float32, len(members)),
+	}
+
+	for i, member := range members {
+		if err = ctx.Err(); err != nil {
+			return SimilarityMatrix{}, err
+		}
+
+		matrix.Values[i] = make([]float32, len(members))
+		memberVotes := listToSet(votes[member.Id])
+
+		for j, other := range members {
+			if i == j {
+				matrix.Values[i][j] = 1
+			} else if j < i {
+				matrix.Values[i][j] = matrix.Values[j][i]
+			} else if len(memberVotes) > 0 || len(votes[other.Id]) > 0 {
+				matrix.Values[i][j] = calculateJaccardSimilarity(memberVotes, listToSet(votes[other.Id]))
+			}
+		}
+	}
+
+	return matrix, nil
 }
 
 func listToSet(list []string) map[string]bool {
@@ -718,8 +1178,11 @@ func calculateJaccardSimilarity(votes1, votes2 map[string]bool) float32 {
 	return float32(intersection) / float32(union)
 }
 
-func GetTrackArtists(trackId string) ([]Artist, error) {
-	rows, err := DB.Query("SELECT id, name, popularity, followers FROM artist JOIN track_artists ON track_artists.artist_id = artist.id WHERE track_id = ? ", trackId)
+func GetTrackArtists(ctx context.Context, trackId string) (_ []Artist, err error) {
+	ctx, span := startSpan(ctx, "GetTrackArtists")
+	defer endSpan(span, &err)
+
+	rows, err := trackArtistsStmt.QueryContext(ctx, trackId)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// NormalizedScore describes a result relative to the rest of its round, so
+// results from rounds with different numbers of voters can be compared.
+type NormalizedScore struct {
+	Share      float64 `json:"share"`
+	ZScore     float64 `json:"z_score"`
+	Percentile float64 `json:"percentile"`
+}
+
+type CareerStats struct {
+	Rounds            int     `json:"rounds"`
+	Points            int     `json:"points"`
+	Wins              int     `json:"wins"`
+	Podiums           int     `json:"podiums"`
+	AverageShare      float64 `json:"average_share"`
+	AverageZScore     float64 `json:"average_z_score"`
+	AveragePercentile float64 `json:"average_percentile"`
+}
+
+type CareerLeague struct {
+	League League `json:"league"`
+	CareerStats
+}
+
+type Career struct {
+	Member  Member         `json:"member"`
+	Leagues []CareerLeague `json:"leagues"`
+	CareerStats
+}
+
+// normalizeScores computes each member's share of the round's total votes,
+// z-score against the round's mean, and percentile placement, where 1 means
+// they beat everyone else and 0 means everyone beat them.
+func normalizeScores(points map[string]int, totalVotes int) map[string]NormalizedScore {
+	scores := make(map[string]NormalizedScore, len(points))
+	if len(points) == 0 {
+		return scores
+	}
+
+	var sum float64
+	for _, value := range points {
+		sum += float64(value)
+	}
+	average := sum / float64(len(points))
+
+	// Summed in a stable order so the result is the same on every run.
+	memberIds := make([]string, 0, len(points))
+	for memberId := range points {
+		memberIds = append(memberIds, memberId)
+	}
+	sort.Strings(memberIds)
+
+	var variance float64
+	for _, memberId := range memberIds {
+		variance += math.Pow(float64(points[memberId])-average, 2)
+	}
+	stddev := math.Sqrt(variance / float64(len(points)))
+
+	for memberId, value := range points {
+		score := NormalizedScore{Percentile: 1}
+
+		if totalVotes != 0 {
+			score.Share = float64(value) / float64(totalVotes)
+		}
+		if stddev > 0 {
+			score.ZScore = (float64(value) - average) / stddev
+		}
+
+		if len(points) > 1 {
+			var beaten, tied float64
+			for otherId, other := range points {
+				if otherId == memberId {
+					continue
+				}
+				if value > other {
+					beaten++
+				} else if value == other {
+					tied++
+				}
+			}
+			score.Percentile = (beaten + tied/2) / float64(len(points)-1)
+		}
+
+		scores[memberId] = score
+	}
+
+	return scores
+}
+
+func GetCareer(ctx context.Context, memberId string) (_ Career, err error) {
+	ctx, span := startSpan(ctx, "GetCareer")
+	defer endSpan(span, &err)
+
+	member, err := GetMemberById(ctx, memberId)
+	if err != nil || member.Id == "" {
+		return Career{}, err
+	}
+
+	leagues, err := GetLeagues(ctx)
+	if err != nil {
+		return Career{}, err
+	}
+
+	career := Career{
+		Member:  member,
+		Leagues: make([]CareerLeague, 0),
+	}
+
+	for _, league := range leagues {
+		results, err := GetLeagueRoundResults(ctx, league.Id)
+		if err != nil {
+			return Career{}, err
+		}
+
+		stats := CareerStats{}
+		for _, result := range results {
+			points, played := result.Points[memberId]
+			if !played {
+				continue
+			}
+
+			score := result.Normalized()[memberId]
+			placement := result.Placements()[memberId]
+
+			stats.Rounds++
+			stats.Points += points
+			if placement == 1 {
+				stats.Wins++
+			}
+			if placement <= 3 {
+				stats.Podiums++
+			}
+			stats.AverageShare += score.Share
+			stats.AverageZScore += score.ZScore
+			stats.AveragePercentile += score.Percentile
+		}
+
+		if stats.Rounds == 0 {
+			continue
+		}
+
+		career.Rounds += stats.Rounds
+		career.Points += stats.Points
+		career.Wins += stats.Wins
+		career.Podiums += stats.Podiums
+		career.AverageShare += stats.AverageShare
+		career.AverageZScore += stats.AverageZScore
+		career.AveragePercentile += stats.AveragePercentile
+
+		stats.average()
+		career.Leagues = append(career.Leagues, CareerLeague{League: league, CareerStats: stats})
+	}
+
+	career.average()
+
+	return career, nil
+}
+
+// average turns the summed normalized scores into averages over the rounds played.
+func (s *CareerStats) average() {
+	if s.Rounds == 0 {
+		return
+	}
+
+	s.AverageShare /= float64(s.Rounds)
+	s.AverageZScore /= float64(s.Rounds)
+	s.AveragePercentile /= float64(s.Rounds)
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeScores(t *testing.T) {
+	tests := []struct {
+		name       string
+		points     map[string]int
+		totalVotes int
+		want       map[string]NormalizedScore
+	}{
+		{
+			name:       "spread",
+			points:     map[string]int{"a": 6, "b": 3, "c": 0},
+			totalVotes: 9,
+			want: map[string]NormalizedScore{
+				"a": {Share: 2.0 / 3, ZScore: math.Sqrt(1.5), Percentile: 1},
+				"b": {Share: 1.0 / 3, ZScore: 0, Percentile: 0.5},
+				"c": {Share: 0, ZScore: -math.Sqrt(1.5), Percentile: 0},
+			},
+		},
+		{
+			name:       "tie for first",
+			points:     map[string]int{"a": 4, "b": 4, "c": 1},
+			totalVotes: 9,
+			want: map[string]NormalizedScore{
+				"a": {Share: 4.0 / 9, ZScore: 1 / math.Sqrt(2), Percentile: 0.75},
+				"b": {Share: 4.0 / 9, ZScore: 1 / math.Sqrt(2), Percentile: 0.75},
+				"c": {Share: 1.0 / 9, ZScore: -math.Sqrt(2), Percentile: 0},
+			},
+		},
+		{
+			name:       "nobody scored",
+			points:     map[string]int{"a": 0, "b": 0},
+			totalVotes: 0,
+			want: map[string]NormalizedScore{
+				"a": {Percentile: 0.5},
+				"b": {Percentile: 0.5},
+			},
+		},
+		{
+			name:       "one submitter",
+			points:     map[string]int{"a": 5},
+			totalVotes: 5,
+			want:       map[string]NormalizedScore{"a": {Share: 1, Percentile: 1}},
+		},
+		{
+			name: "no submitters",
+			want: map[string]NormalizedScore{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := normalizeScores(test.points, test.totalVotes)
+			if len(got) != len(test.want) {
+				t.Fatalf("normalizeScores = %v, want %v", got, test.want)
+			}
+
+			for memberId, want := range test.want {
+				score := got[memberId]
+				if math.Abs(score.Share-want.Share) > 1e-9 ||
+					math.Abs(score.ZScore-want.ZScore) > 1e-9 ||
+					math.Abs(score.Percentile-want.Percentile) > 1e-9 {
+					t.Errorf("%s scored %+v, want %+v", memberId, score, want)
+				}
+			}
+		})
+	}
+}
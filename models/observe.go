@@ -0,0 +1,269 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Query describes a query the models ran, for ObserveQueries.
+type Query struct {
+	// Func is the model function the query was run for, like GetRounds. When
+	// one model calls another, the queries are counted against the outer one.
+	Func     string
+	SQL      string
+	Start    time.Time
+	Duration time.Duration
+	// Err is why the query failed, if it did.
+	Err error
+}
+
+var queryObservers []func(ctx context.Context, query Query)
+
+// ObserveQueries calls fn after every query has run and its rows have been
+// read, with the context it was run with. Observers have to be added before
+// any queries run.
+func ObserveQueries(fn func(ctx context.Context, query Query)) {
+	queryObservers = append(queryObservers, fn)
+}
+
+// observation times one query for the observers.
+type observation struct {
+	ctx   context.Context
+	query Query
+}
+
+// observe starts timing a query, or returns nil if nothing is observing them.
+func observe(ctx context.Context, query string) *observation {
+	if len(queryObservers) == 0 {
+		return nil
+	}
+
+	return &observation{ctx: ctx, query: Query{Func: modelFunc(ctx), SQL: query, Start: time.Now()}}
+}
+
+func (o *observation) done(err error) {
+	if o == nil {
+		return
+	}
+
+	o.query.Duration = time.Since(o.query.Start)
+	o.query.Err = err
+	for _, fn := range queryObservers {
+		fn(o.ctx, o.query)
+	}
+}
+
+type funcKey struct{}
+
+// tracer starts a span for each model function a request calls.
+var tracer = otel.Tracer("github.com/thePurpleMonkey/music-league-stats-server/models")
+
+// startSpan starts the span for a model function inside the one in ctx, if
+// that's being recorded, and notes the function in the context so the
+// queries run with it are counted against it. When one model calls another,
+// the queries stay with the outer one.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if ctx.Value(funcKey{}) == nil {
+		ctx = context.WithValue(ctx, funcKey{}, name)
+	}
+
+	if parent := trace.SpanFromContext(ctx); !parent.IsRecording() {
+		return ctx, parent
+	}
+
+	return tracer.Start(ctx, name)
+}
+
+// endSpan ends a model function's span, marking it failed if *err is set.
+// Deferred with the address of the function's error result, it sees what the
+// function returned:
+//
+//	func f(ctx context.Context) (err error) {
+//		ctx, span := startSpan(ctx, "f")
+//		defer endSpan(span, &err)
+//
+// A canceled context means the caller gave up, so it isn't a failure.
+func endSpan(span trace.Span, err *error) {
+	if *err != nil && !errors.Is(*err, context.Canceled) {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+
+	span.End()
+}
+
+// modelFunc returns the model function a query was run for, or an empty
+// string if it wasn't run with a model's context.
+func modelFunc(ctx context.Context) string {
+	name, _ := ctx.Value(funcKey{}).(string)
+	return name
+}
+
+// observedConnector opens SQLite connections that tell the observers about
+// each query they run.
+type observedConnector struct {
+	dsn string
+}
+
+func (c observedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &observedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+func (c observedConnector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+type observedConn struct {
+	conn *sqlite3.SQLiteConn
+}
+
+func (c *observedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &observedStmt{stmt: stmt.(*sqlite3.SQLiteStmt), query: query, cached: isStatement(query)}, nil
+}
+
+func (c *observedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *observedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.conn.BeginTx(ctx, opts)
+}
+
+func (c *observedConn) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	o := observe(ctx, query)
+	result, err := c.conn.ExecContext(ctx, query, args)
+	o.done(err)
+
+	return result, err
+}
+
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	o := observe(ctx, query)
+	rows, err := c.conn.QueryContext(ctx, query, args)
+	if err != nil {
+		o.done(err)
+		return nil, err
+	}
+
+	return &observedRows{rows: rows, o: o}, nil
+}
+
+type observedStmt struct {
+	stmt  *sqlite3.SQLiteStmt
+	query string
+	// cached is set for the statements prepared by PrepareStatements, and
+	// used once one has run on this connection.
+	cached bool
+	used   bool
+}
+
+func (s *observedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *observedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *observedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s *observedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+func (s *observedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	s.countUse()
+
+	o := observe(ctx, s.query)
+	result, err := s.stmt.ExecContext(ctx, args)
+	o.done(err)
+
+	return result, err
+}
+
+func (s *observedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	s.countUse()
+
+	o := observe(ctx, s.query)
+	rows, err := s.stmt.QueryContext(ctx, args)
+	if err != nil {
+		o.done(err)
+		return nil, err
+	}
+
+	return &observedRows{rows: rows, o: o}, nil
+}
+
+// countUse counts a hit if the statement has been used on this connection
+// before, and a miss if it had to be prepared for it.
+func (s *observedStmt) countUse() {
+	switch {
+	case !s.cached:
+	case s.used:
+		statementHits.Add(1)
+	default:
+		statementMisses.Add(1)
+		s.used = true
+	}
+}
+
+// observedRows finishes timing its query once the rows are closed, since
+// SQLite does most of the work as they're read.
+type observedRows struct {
+	rows driver.Rows
+	o    *observation
+	err  error
+}
+
+func (r *observedRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *observedRows) Next(dest []driver.Value) error {
+	err := r.rows.Next(dest)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+
+	return err
+}
+
+func (r *observedRows) Close() error {
+	err := r.rows.Close()
+	r.o.done(r.err)
+	r.o = nil
+
+	return err
+}
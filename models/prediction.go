@@ -0,0 +1,501 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+)
+
+// Number of pseudo-rounds of a voter's average behavior blended into each
+// voter-submitter affinity, so a single lucky round doesn't dominate.
+const affinitySmoothing = 2.0
+
+type Prediction struct {
+	Submitter      Member  `json:"submitter"`
+	Track          Track   `json:"track"`
+	ExpectedPoints float64 `json:"expected_points"`
+	PredictedRank  int     `json:"predicted_rank"`
+}
+
+type BacktestRound struct {
+	Round           Round        `json:"round"`
+	RankCorrelation float64      `json:"rank_correlation"`
+	Top3HitRate     float64      `json:"top3_hit_rate"`
+	Predictions     []Prediction `json:"predictions"`
+}
+
+type Backtest struct {
+	League              League          `json:"league"`
+	Rounds              []BacktestRound `json:"rounds"`
+	MeanRankCorrelation float64         `json:"mean_rank_correlation"`
+	MeanTop3HitRate     float64         `json:"mean_top3_hit_rate"`
+}
+
+type historyRound struct {
+	id          string
+	submissions map[string]string         // submitter -> track
+	votes       map[string]map[string]int // voter -> recipient -> points
+}
+
+// submitters returns the round's submitters in a stable order, so that
+// floating point sums over them come out the same on every run.
+func (r historyRound) submitters() []string {
+	submitters := make([]string, 0, len(r.submissions))
+	for submitterId := range r.submissions {
+		submitters = append(submitters, submitterId)
+	}
+	sort.Strings(submitters)
+
+	return submitters
+}
+
+// voters returns the round's voters in a stable order.
+func (r historyRound) voters() []string {
+	voters := make([]string, 0, len(r.votes))
+	for voterId := range r.votes {
+		voters = append(voters, voterId)
+	}
+	sort.Strings(voters)
+
+	return voters
+}
+
+type leagueHistory struct {
+	rounds     []historyRound
+	popularity map[string]float64 // track -> mean artist popularity
+}
+
+type predictor struct {
+	given         map[string]map[string]int
+	meetings      map[string]map[string]int
+	totalGiven    map[string]int
+	opportunities map[string]int
+	globalBase    float64
+	meanPop       float64
+	popSlope      float64
+	popularity    map[string]float64
+}
+
+// PredictRound estimates the points each submission in a round will receive,
+// based only on the rounds of the same league that came before it.
+func PredictRound(ctx context.Context, roundId string) (_ []Prediction, err error) {
+	ctx, span := startSpan(ctx, "PredictRound")
+	defer endSpan(span, &err)
+
+	var leagueId string
+	err = DB.QueryRowContext(ctx, "SELECT league_id FROM submissions WHERE round_id = ? LIMIT 1", roundId).Scan(&leagueId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	history, err := loadLeagueHistory(ctx, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, round := range history.rounds {
+		if round.id == roundId {
+			return newPredictor(history, history.rounds[:i]).predict(ctx, round)
+		}
+	}
+
+	return nil, nil
+}
+
+// BacktestLeague replays a league's rounds in sequence order, predicting each
+// round from the ones before it and comparing the predictions with the actual
+// results. The first round has no history and is skipped.
+func BacktestLeague(ctx context.Context, leagueId string) (_ Backtest, err error) {
+	ctx, span := startSpan(ctx, "BacktestLeague")
+	defer endSpan(span, &err)
+
+	league, err := GetLeagueById(ctx, leagueId)
+	if err != nil || league.Id == "" {
+		return Backtest{}, err
+	}
+
+	history, err := loadLeagueHistory(ctx, leagueId)
+	if err != nil {
+		return Backtest{}, err
+	}
+
+	backtest := Backtest{
+		League: league,
+		Rounds: make([]BacktestRound, 0),
+	}
+
+	for i := 1; i < len(history.rounds); i++ {
+		round := history.rounds[i]
+		predictions, err := newPredictor(history, history.rounds[:i]).predict(ctx, round)
+		if err != nil {
+			return Backtest{}, err
+		}
+
+		result := BacktestRound{Predictions: predictions}
+		if result.Round, err = GetRoundById(ctx, round.id); err != nil {
+			return Backtest{}, err
+		}
+
+		actual := make(map[string]float64)
+		for submitter := range round.submissions {
+			actual[submitter] = 0
+		}
+		for _, recipients := range round.votes {
+			for recipient, points := range recipients {
+				actual[recipient] += float64(points)
+			}
+		}
+
+		predicted := make([]float64, 0, len(predictions))
+		observed := make([]float64, 0, len(predictions))
+		for _, prediction := range predictions {
+			predicted = append(predicted, prediction.ExpectedPoints)
+			observed = append(observed, actual[prediction.Submitter.Id])
+		}
+
+		result.RankCorrelation = spearman(predicted, observed)
+		result.Top3HitRate = topHitRate(predicted, observed, 3)
+
+		backtest.MeanRankCorrelation += result.RankCorrelation
+		backtest.MeanTop3HitRate += result.Top3HitRate
+		backtest.Rounds = append(backtest.Rounds, result)
+	}
+
+	if len(backtest.Rounds) > 0 {
+		backtest.MeanRankCorrelation /= float64(len(backtest.Rounds))
+		backtest.MeanTop3HitRate /= float64(len(backtest.Rounds))
+	}
+
+	return backtest, nil
+}
+
+func loadLeagueHistory(ctx context.Context, leagueId string) (leagueHistory, error) {
+	history := leagueHistory{popularity: make(map[string]float64)}
+	index := make(map[string]int)
+
+	rows, err := DB.QueryContext(ctx, "SELECT round_id, submitter_id, track_id FROM submissions JOIN rounds ON submissions.round_id = rounds.id WHERE submissions.league_id = ? ORDER BY sequence, round_id", leagueId)
+	if err != nil {
+		return history, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roundId, submitterId, trackId string
+		if err = rows.Scan(&roundId, &submitterId, &trackId); err != nil {
+			return history, err
+		}
+
+		if _, exists := index[roundId]; !exists {
+			index[roundId] = len(history.rounds)
+			history.rounds = append(history.rounds, historyRound{
+				id:          roundId,
+				submissions: make(map[string]string),
+				votes:       make(map[string]map[string]int),
+			})
+		}
+		history.rounds[index[roundId]].submissions[submitterId] = trackId
+	}
+
+	if err = rows.Err(); err != nil {
+		return history, err
+	}
+
+	voteRows, err := DB.QueryContext(ctx, "SELECT round_id, voter_id, recipient_id, votes FROM results WHERE league_id = ?", leagueId)
+	if err != nil {
+		return history, err
+	}
+	defer voteRows.Close()
+
+	for voteRows.Next() {
+		var roundId, voterId, recipientId string
+		var votes int
+		if err = voteRows.Scan(&roundId, &voterId, &recipientId, &votes); err != nil {
+			return history, err
+		}
+
+		i, exists := index[roundId]
+		if !exists {
+			continue
+		}
+		if history.rounds[i].votes[voterId] == nil {
+			history.rounds[i].votes[voterId] = make(map[string]int)
+		}
+		history.rounds[i].votes[voterId][recipientId] += votes
+	}
+
+	if err = voteRows.Err(); err != nil {
+		return history, err
+	}
+
+	popRows, err := DB.QueryContext(ctx, "SELECT track_id, AVG(popularity) FROM track_artists JOIN artist ON track_artists.artist_id = artist.id WHERE popularity >= 0 AND track_id IN (SELECT track_id FROM submissions WHERE league_id = ?) GROUP BY track_id", leagueId)
+	if err != nil {
+		return history, err
+	}
+	defer popRows.Close()
+
+	for popRows.Next() {
+		var trackId string
+		var popularity float64
+		if err = popRows.Scan(&trackId, &popularity); err != nil {
+			return history, err
+		}
+		history.popularity[trackId] = popularity
+	}
+
+	return history, popRows.Err()
+}
+
+func newPredictor(history leagueHistory, past []historyRound) *predictor {
+	p := &predictor{
+		given:         make(map[string]map[string]int),
+		meetings:      make(map[string]map[string]int),
+		totalGiven:    make(map[string]int),
+		opportunities: make(map[string]int),
+		popularity:    history.popularity,
+	}
+
+	var allGiven, allOpportunities int
+	for _, round := range past {
+		for voterId, recipients := range round.votes {
+			if p.given[voterId] == nil {
+				p.given[voterId] = make(map[string]int)
+				p.meetings[voterId] = make(map[string]int)
+			}
+			for recipientId, points := range recipients {
+				p.given[voterId][recipientId] += points
+				p.totalGiven[voterId] += points
+				allGiven += points
+			}
+			for submitterId := range round.submissions {
+				if submitterId == voterId {
+					continue
+				}
+				p.meetings[voterId][submitterId]++
+				p.opportunities[voterId]++
+				allOpportunities++
+			}
+		}
+	}
+
+	if allOpportunities > 0 {
+		p.globalBase = float64(allGiven) / float64(allOpportunities)
+	}
+
+	p.fitPopularity(past)
+
+	return p
+}
+
+// fitPopularity estimates how strongly artist popularity moves a submission's
+// share of the points, as a least-squares slope of relative score against
+// popularity.
+func (p *predictor) fitPopularity(past []historyRound) {
+	var xs, ys []float64
+
+	for _, round := range past {
+		received := make(map[string]float64)
+		var total float64
+		for _, recipients := range round.votes {
+			for recipientId, points := range recipients {
+				received[recipientId] += float64(points)
+				total += float64(points)
+			}
+		}
+		if total == 0 || len(round.submissions) == 0 {
+			continue
+		}
+
+		average := total / float64(len(round.submissions))
+		for _, submitterId := range round.submitters() {
+			trackId := round.submissions[submitterId]
+			if popularity, known := p.popularity[trackId]; known {
+				xs = append(xs, popularity)
+				ys = append(ys, received[submitterId]/average)
+			}
+		}
+	}
+
+	if len(xs) < 2 {
+		return
+	}
+
+	p.meanPop = mean(xs)
+	meanY := mean(ys)
+
+	var covariance, variance float64
+	for i := range xs {
+		covariance += (xs[i] - p.meanPop) / 100 * (ys[i] - meanY)
+		variance += math.Pow((xs[i]-p.meanPop)/100, 2)
+	}
+	if variance > 0 {
+		p.popSlope = math.Max(-1, math.Min(1, covariance/variance))
+	}
+}
+
+// affinity is the smoothed average number of points voterId gives
+// submitterId in a round where both take part.
+func (p *predictor) affinity(voterId, submitterId string) float64 {
+	base := p.globalBase
+	if p.opportunities[voterId] > 0 {
+		base = float64(p.totalGiven[voterId]) / float64(p.opportunities[voterId])
+	}
+
+	given := float64(p.given[voterId][submitterId])
+	met := float64(p.meetings[voterId][submitterId])
+
+	return (given + affinitySmoothing*base) / (met + affinitySmoothing)
+}
+
+func (p *predictor) popularityFactor(trackId string) float64 {
+	popularity, known := p.popularity[trackId]
+	if !known {
+		return 1
+	}
+
+	return math.Max(0, 1+p.popSlope*(popularity-p.meanPop)/100)
+}
+
+func (p *predictor) predict(ctx context.Context, round historyRound) ([]Prediction, error) {
+	predictions := make([]Prediction, 0, len(round.submissions))
+	submitters := round.submitters()
+
+	for _, submitterId := range submitters {
+		trackId := round.submissions[submitterId]
+		prediction := Prediction{}
+
+		var expected float64
+		for _, voterId := range submitters {
+			if voterId != submitterId {
+				expected += p.affinity(voterId, submitterId)
+			}
+		}
+		prediction.ExpectedPoints = expected * p.popularityFactor(trackId)
+
+		var err error
+		if prediction.Submitter, err = GetMemberById(ctx, submitterId); err != nil {
+			return nil, err
+		}
+		if prediction.Track, err = GetTrackById(ctx, trackId); err != nil {
+			return nil, err
+		}
+
+		predictions = append(predictions, prediction)
+	}
+
+	sort.Slice(predictions, func(i, j int) bool {
+		if predictions[i].ExpectedPoints != predictions[j].ExpectedPoints {
+			return predictions[i].ExpectedPoints > predictions[j].ExpectedPoints
+		}
+		return predictions[i].Submitter.Id < predictions[j].Submitter.Id
+	})
+
+	for i := range predictions {
+		predictions[i].PredictedRank = i + 1
+	}
+
+	return predictions, nil
+}
+
+// spearman returns the Spearman rank correlation of two samples, using
+// average ranks for ties.
+func spearman(xs, ys []float64) float64 {
+	return pearson(ranks(xs), ranks(ys))
+}
+
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return values[order[i]] > values[order[j]]
+	})
+
+	result := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && values[order[j+1]] == values[order[i]] {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			result[order[k]] = rank
+		}
+		i = j + 1
+	}
+
+	return result
+}
+
+func pearson(xs, ys []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+
+	meanX, meanY := mean(xs), mean(ys)
+
+	var covariance, varianceX, varianceY float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+		varianceX += (xs[i] - meanX) * (xs[i] - meanX)
+		varianceY += (ys[i] - meanY) * (ys[i] - meanY)
+	}
+
+	if varianceX == 0 || varianceY == 0 {
+		return 0
+	}
+
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
+
+// topHitRate is the fraction of the entries predicted to place in the top n
+// that also placed there. An entry places in the top n if fewer than n
+// entries beat it, so entries tied at the cutoff are in or out together.
+func topHitRate(predicted, observed []float64, n int) float64 {
+	top := func(values []float64) map[int]bool {
+		set := make(map[int]bool)
+		for i, value := range values {
+			placement := 1
+			for _, other := range values {
+				if other > value {
+					placement++
+				}
+			}
+			if placement <= n {
+				set[i] = true
+			}
+		}
+		return set
+	}
+
+	predictedTop, observedTop := top(predicted), top(observed)
+	if len(predictedTop) == 0 {
+		return 0
+	}
+
+	hits := 0
+	for i := range predictedTop {
+		if observedTop[i] {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(len(predictedTop))
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+
+	return sum / float64(len(values))
+}
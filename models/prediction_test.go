@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestTopHitRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		predicted []float64
+		observed  []float64
+		want      float64
+	}{
+		{"no ties", []float64{5, 4, 3, 2, 1}, []float64{5, 4, 1, 3, 2}, 2.0 / 3},
+		{"observed tie at the cutoff", []float64{5, 4, 3, 2, 1}, []float64{5, 4, 3, 3, 1}, 1},
+		{"observed tie at the cutoff, reordered", []float64{5, 4, 2, 3, 1}, []float64{5, 4, 3, 3, 1}, 1},
+		{"predicted tie at the cutoff", []float64{1, 1, 1, 1}, []float64{4, 3, 2, 1}, 3.0 / 4},
+		{"fewer entries than n", []float64{2, 1}, []float64{1, 2}, 1},
+		{"no entries", nil, nil, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := topHitRate(test.predicted, test.observed, 3); got != test.want {
+				t.Errorf("topHitRate(%v, %v, 3) = %v, want %v", test.predicted, test.observed, got, test.want)
+			}
+		})
+	}
+}
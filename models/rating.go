@@ -0,0 +1,217 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+const (
+	initialRating = 1500.0
+	ratingK       = 32.0
+)
+
+type Rating struct {
+	Member Member  `json:"member"`
+	Rating float64 `json:"rating"`
+	Rounds int     `json:"rounds"`
+	Rank   int     `json:"rank"`
+}
+
+type RatingChange struct {
+	Round        Round   `json:"round"`
+	LeagueId     string  `json:"league_id"`
+	RatingBefore float64 `json:"rating_before"`
+	RatingAfter  float64 `json:"rating_after"`
+	Change       float64 `json:"change"`
+	Placement    int     `json:"placement"`
+	Opponents    int     `json:"opponents"`
+}
+
+type ratingMatch struct {
+	leagueId string
+	result   RoundResult
+}
+
+type ratingHistory struct {
+	ratings map[string]float64
+	rounds  map[string]int
+	changes map[string][]RatingChange
+}
+
+// GetRatings returns every member's current Elo rating, highest first.
+func GetRatings(ctx context.Context) (_ []Rating, err error) {
+	ctx, span := startSpan(ctx, "GetRatings")
+	defer endSpan(span, &err)
+
+	leagues, err := GetLeagues(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := computeRatings(ctx, leagues)
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := make([]Rating, 0, len(history.ratings))
+
+	for memberId, value := range history.ratings {
+		rating := Rating{
+			Rating: value,
+			Rounds: history.rounds[memberId],
+		}
+		if rating.Member, err = GetMemberById(ctx, memberId); err != nil {
+			return nil, err
+		}
+
+		ratings = append(ratings, rating)
+	}
+
+	sort.Slice(ratings, func(i, j int) bool {
+		if ratings[i].Rating != ratings[j].Rating {
+			return ratings[i].Rating > ratings[j].Rating
+		}
+		return ratings[i].Member.Id < ratings[j].Member.Id
+	})
+
+	for i := range ratings {
+		ratings[i].Rank = i + 1
+	}
+
+	return ratings, nil
+}
+
+// GetMemberRatingHistory returns how a member's rating changed with every round
+// they took part in, in the order the rounds were rated.
+func GetMemberRatingHistory(ctx context.Context, memberId string) (_ []RatingChange, err error) {
+	ctx, span := startSpan(ctx, "GetMemberRatingHistory")
+	defer endSpan(span, &err)
+
+	leagues, err := GetLeagues(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := computeRatings(ctx, leagues)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := history.changes[memberId]
+	if changes == nil {
+		return nil, nil
+	}
+
+	for i := range changes {
+		if changes[i].Round, err = GetRoundById(ctx, changes[i].Round.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// computeRatings treats every round as a multi-player match and rates the
+// submitters with pairwise Elo: each pair of submitters is scored as a win,
+// loss or draw on points, and the K-factor is split across opponents so a
+// round moves a rating the same amount no matter how many people took part.
+// Only the rounds of the given leagues are rated, in sequence order,
+// interleaving leagues.
+func computeRatings(ctx context.Context, leagues []League) (ratingHistory, error) {
+	history := ratingHistory{
+		ratings: make(map[string]float64),
+		rounds:  make(map[string]int),
+		changes: make(map[string][]RatingChange),
+	}
+
+	matches := make([]ratingMatch, 0)
+	for _, league := range leagues {
+		results, err := GetLeagueRoundResults(ctx, league.Id)
+		if err != nil {
+			return history, err
+		}
+		for _, result := range results {
+			matches = append(matches, ratingMatch{leagueId: league.Id, result: result})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].result.Sequence != matches[j].result.Sequence {
+			return matches[i].result.Sequence < matches[j].result.Sequence
+		}
+		return matches[i].leagueId < matches[j].leagueId
+	})
+
+	for _, match := range matches {
+		players := match.result.Ranking()
+		if len(players) < 2 {
+			continue
+		}
+
+		for _, memberId := range players {
+			if _, exists := history.ratings[memberId]; !exists {
+				history.ratings[memberId] = initialRating
+			}
+		}
+
+		updated := rateRound(history.ratings, match.result)
+
+		placements := match.result.Placements()
+		for _, memberId := range players {
+			history.changes[memberId] = append(history.changes[memberId], RatingChange{
+				Round:        Round{Id: match.result.RoundId},
+				LeagueId:     match.leagueId,
+				RatingBefore: history.ratings[memberId],
+				RatingAfter:  updated[memberId],
+				Change:       updated[memberId] - history.ratings[memberId],
+				Placement:    placements[memberId],
+				Opponents:    len(players) - 1,
+			})
+			history.rounds[memberId]++
+		}
+
+		for memberId, rating := range updated {
+			history.ratings[memberId] = rating
+		}
+	}
+
+	return history, nil
+}
+
+// rateRound returns the new rating of each member who took part in a round,
+// given their ratings before it. Each one plays every other, and the changes
+// are averaged over their opponents.
+func rateRound(ratings map[string]float64, result RoundResult) map[string]float64 {
+	players := result.Ranking()
+
+	updated := make(map[string]float64, len(players))
+	for _, memberId := range players {
+		var delta float64
+		for _, opponentId := range players {
+			if opponentId == memberId {
+				continue
+			}
+			delta += matchScore(result.Points[memberId], result.Points[opponentId]) -
+				expectedScore(ratings[memberId], ratings[opponentId])
+		}
+		updated[memberId] = ratings[memberId] + ratingK*delta/float64(len(players)-1)
+	}
+
+	return updated
+}
+
+func expectedScore(rating, opponentRating float64) float64 {
+	return 1 / (1 + math.Pow(10, (opponentRating-rating)/400))
+}
+
+func matchScore(points, opponentPoints int) float64 {
+	switch {
+	case points > opponentPoints:
+		return 1
+	case points < opponentPoints:
+		return 0
+	default:
+		return 0.5
+	}
+}
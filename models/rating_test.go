@@ -0,0 +1,86 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpectedScore(t *testing.T) {
+	tests := []struct {
+		rating, opponentRating float64
+		want                   float64
+	}{
+		{1500, 1500, 0.5},
+		{1900, 1500, 10.0 / 11},
+		{1500, 1900, 1.0 / 11},
+	}
+
+	for _, test := range tests {
+		if got := expectedScore(test.rating, test.opponentRating); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("expectedScore(%v, %v) = %v, want %v", test.rating, test.opponentRating, got, test.want)
+		}
+	}
+}
+
+func TestRateRound(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratings map[string]float64
+		points  map[string]int
+		want    map[string]float64
+	}{
+		{
+			name:    "even players, one wins",
+			ratings: map[string]float64{"a": 1500, "b": 1500},
+			points:  map[string]int{"a": 10, "b": 4},
+			want:    map[string]float64{"a": 1516, "b": 1484},
+		},
+		{
+			name:    "even players tie",
+			ratings: map[string]float64{"a": 1500, "b": 1500},
+			points:  map[string]int{"a": 7, "b": 7},
+			want:    map[string]float64{"a": 1500, "b": 1500},
+		},
+		{
+			name:    "favourite wins",
+			ratings: map[string]float64{"a": 1600, "b": 1400},
+			points:  map[string]int{"a": 10, "b": 4},
+			want:    map[string]float64{"a": 1607.6880993, "b": 1392.3119007},
+		},
+		{
+			name:    "underdog wins",
+			ratings: map[string]float64{"a": 1600, "b": 1400},
+			points:  map[string]int{"a": 4, "b": 10},
+			want:    map[string]float64{"a": 1575.6880993, "b": 1424.3119007},
+		},
+		{
+			// Changes are averaged over opponents, so the middle player
+			// who beat one and lost to one doesn't move.
+			name:    "three even players",
+			ratings: map[string]float64{"a": 1500, "b": 1500, "c": 1500},
+			points:  map[string]int{"a": 10, "b": 5, "c": 0},
+			want:    map[string]float64{"a": 1516, "b": 1500, "c": 1484},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := rateRound(test.ratings, RoundResult{Points: test.points})
+			if len(got) != len(test.want) {
+				t.Fatalf("rateRound rated %v, want %v", got, test.want)
+			}
+
+			var before, after float64
+			for memberId, want := range test.want {
+				if math.Abs(got[memberId]-want) > 1e-6 {
+					t.Errorf("%s is rated %v, want %v", memberId, got[memberId], want)
+				}
+				before += test.ratings[memberId]
+				after += got[memberId]
+			}
+			if math.Abs(before-after) > 1e-6 {
+				t.Errorf("ratings sum to %v after the round and %v before it", after, before)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"unicode/utf8"
+)
+
+// Each submission in a recap quotes at most this many vote comments.
+const recapComments = 2
+
+type RecapEntry struct {
+	Placement  int        `json:"placement"`
+	Points     int        `json:"points"`
+	Submission Submission `json:"submission"`
+	Comments   []Vote     `json:"comments"`
+}
+
+type RecapSurprise struct {
+	Entry         RecapEntry `json:"entry"`
+	PredictedRank int        `json:"predicted_rank"`
+}
+
+type RoundRecap struct {
+	Round        Round          `json:"round"`
+	Podium       []RecapEntry   `json:"podium"`
+	Entries      []RecapEntry   `json:"entries"`
+	Surprise     *RecapSurprise `json:"surprise,omitempty"`
+	Shutouts     []Member       `json:"shutouts"`
+	WinnerVoters []Vote         `json:"winner_voters"`
+}
+
+// GetRoundRecap summarizes a round for sharing: the podium, every submission
+// with its points and most notable comments, the submission that most beat
+// its predicted placement, who got no points, and who voted for the winner.
+func GetRoundRecap(ctx context.Context, roundId string) (_ RoundRecap, err error) {
+	ctx, span := startSpan(ctx, "GetRoundRecap")
+	defer endSpan(span, &err)
+
+	round, err := GetRoundById(ctx, roundId)
+	if err != nil || round.Id == "" {
+		return RoundRecap{}, err
+	}
+
+	submissions, err := GetSubmissions(ctx, roundId)
+	if err != nil {
+		return RoundRecap{}, err
+	}
+
+	rankings, err := GetRoundRankings(ctx, roundId)
+	if err != nil {
+		return RoundRecap{}, err
+	}
+
+	points := make(map[string]int)
+	placements := make(map[string]int)
+	for _, ranking := range rankings {
+		points[ranking.Member.Id] = ranking.Votes
+		placements[ranking.Member.Id] = ranking.Placement
+	}
+
+	recap := RoundRecap{
+		Round:        round,
+		Podium:       make([]RecapEntry, 0),
+		Entries:      make([]RecapEntry, 0, len(submissions)),
+		Shutouts:     make([]Member, 0),
+		WinnerVoters: make([]Vote, 0),
+	}
+
+	for _, submission := range submissions {
+		entry := RecapEntry{
+			Placement:  placements[submission.Submitter.Id],
+			Points:     points[submission.Submitter.Id],
+			Submission: submission,
+			Comments:   notableComments(submission.Votes),
+		}
+
+		recap.Entries = append(recap.Entries, entry)
+	}
+
+	sort.SliceStable(recap.Entries, func(i, j int) bool {
+		if recap.Entries[i].Placement != recap.Entries[j].Placement {
+			return recap.Entries[i].Placement < recap.Entries[j].Placement
+		}
+		return recap.Entries[i].Submission.Submitter.Name < recap.Entries[j].Submission.Submitter.Name
+	})
+
+	for _, entry := range recap.Entries {
+		if entry.Placement <= 3 && entry.Points > 0 {
+			recap.Podium = append(recap.Podium, entry)
+		}
+		if entry.Points == 0 {
+			recap.Shutouts = append(recap.Shutouts, entry.Submission.Submitter)
+		}
+		if entry.Placement == 1 && entry.Points > 0 {
+			for _, vote := range entry.Submission.Votes {
+				if vote.Votes > 0 {
+					recap.WinnerVoters = append(recap.WinnerVoters, vote)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(recap.WinnerVoters, func(i, j int) bool {
+		return recap.WinnerVoters[i].Votes > recap.WinnerVoters[j].Votes
+	})
+
+	if recap.Surprise, err = biggestSurprise(ctx, roundId, recap.Entries); err != nil {
+		return RoundRecap{}, err
+	}
+
+	return recap, nil
+}
+
+// notableComments picks the comments left with the most points, longest
+// first among equals.
+func notableComments(votes []Vote) []Vote {
+	comments := make([]Vote, 0)
+	for _, vote := range votes {
+		if vote.Comment != "" {
+			comments = append(comments, vote)
+		}
+	}
+
+	sort.SliceStable(comments, func(i, j int) bool {
+		if comments[i].Votes != comments[j].Votes {
+			return comments[i].Votes > comments[j].Votes
+		}
+		return utf8.RuneCountInString(comments[i].Comment) > utf8.RuneCountInString(comments[j].Comment)
+	})
+
+	if len(comments) > recapComments {
+		comments = comments[:recapComments]
+	}
+
+	return comments
+}
+
+// biggestSurprise finds the submission that placed furthest above where it
+// was predicted to, if any did.
+func biggestSurprise(ctx context.Context, roundId string, entries []RecapEntry) (*RecapSurprise, error) {
+	predictions, err := PredictRound(ctx, roundId)
+	if err != nil {
+		return nil, err
+	}
+
+	// With no earlier rounds to learn from every prediction is the same, and
+	// the predicted ranks mean nothing.
+	if len(predictions) == 0 || predictions[0].ExpectedPoints == predictions[len(predictions)-1].ExpectedPoints {
+		return nil, nil
+	}
+
+	predicted := make(map[string]int)
+	for _, prediction := range predictions {
+		predicted[prediction.Submitter.Id] = prediction.PredictedRank
+	}
+
+	var surprise *RecapSurprise
+	bestGain := 0
+
+	for _, entry := range entries {
+		rank, exists := predicted[entry.Submission.Submitter.Id]
+		if !exists {
+			continue
+		}
+
+		if gain := rank - entry.Placement; gain > bestGain {
+			bestGain = gain
+			surprise = &RecapSurprise{Entry: entry, PredictedRank: rank}
+		}
+	}
+
+	return surprise, nil
+}
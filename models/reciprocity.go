@@ -0,0 +1,387 @@
+package models
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+const (
+	DefaultReciprocityIterations = 500
+	DefaultReciprocityAlpha      = 0.05
+)
+
+type ReciprocityNode struct {
+	Member         Member `json:"member"`
+	PointsGiven    int    `json:"points_given"`
+	PointsReceived int    `json:"points_received"`
+}
+
+type ReciprocityEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+type ReciprocityRound struct {
+	RoundId string `json:"round_id"`
+	AToB    int    `json:"a_to_b"`
+	BToA    int    `json:"b_to_a"`
+}
+
+type ReciprocityPair struct {
+	MemberA  string             `json:"member_a"`
+	MemberB  string             `json:"member_b"`
+	AToB     int                `json:"a_to_b"`
+	BToA     int                `json:"b_to_a"`
+	Mutual   int                `json:"mutual"`
+	Expected float64            `json:"expected_mutual"`
+	PValue   float64            `json:"p_value"`
+	Flagged  bool               `json:"flagged"`
+	History  []ReciprocityRound `json:"history"`
+}
+
+type ReciprocityGraph struct {
+	Nodes      []ReciprocityNode `json:"nodes"`
+	Edges      []ReciprocityEdge `json:"edges"`
+	Pairs      []ReciprocityPair `json:"pairs"`
+	Blocs      [][]string        `json:"blocs"`
+	Iterations int               `json:"iterations"`
+	Alpha      float64           `json:"alpha"`
+}
+
+type reciprocityRound struct {
+	id         string
+	submitters []string
+	ballots    map[string]map[string]int // voter -> recipient -> points
+}
+
+// GetReciprocity measures how much each pair of members in a league support
+// each other. A pair's mutual support is the smaller of the points they gave
+// each other, so one-sided fandom doesn't count. Each pair is compared with a
+// baseline built by shuffling every ballot's points across the other
+// submitters in its round, keeping how each voter distributes points but
+// removing who they went to. Pairs whose mutual support is rarely matched by
+// the shuffled baseline are flagged, and groups of three or more members who
+// are all flagged with each other form blocs.
+func GetReciprocity(ctx context.Context, leagueId string, iterations int, alpha float64) (_ ReciprocityGraph, err error) {
+	ctx, span := startSpan(ctx, "GetReciprocity")
+	defer endSpan(span, &err)
+
+	rounds, err := loadReciprocityRounds(ctx, leagueId)
+	if err != nil || len(rounds) == 0 {
+		return ReciprocityGraph{}, err
+	}
+
+	observed := givenTotals(rounds)
+
+	members := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, round := range rounds {
+		for _, memberId := range round.submitters {
+			if !seen[memberId] {
+				seen[memberId] = true
+				members = append(members, memberId)
+			}
+		}
+	}
+	sort.Strings(members)
+
+	// A fixed seed so the same data always flags the same pairs.
+	random := rand.New(rand.NewSource(1))
+	exceeded := make(map[[2]string]int)
+	expected := make(map[[2]string]float64)
+
+	for i := 0; i < iterations; i++ {
+		shuffled := givenTotals(shuffleBallots(rounds, random))
+		for a := 0; a < len(members); a++ {
+			for b := a + 1; b < len(members); b++ {
+				key := [2]string{members[a], members[b]}
+				mutual := mutualSupport(shuffled, members[a], members[b])
+				expected[key] += float64(mutual)
+				if mutual >= mutualSupport(observed, members[a], members[b]) {
+					exceeded[key]++
+				}
+			}
+		}
+	}
+
+	graph := ReciprocityGraph{
+		Nodes:      make([]ReciprocityNode, 0, len(members)),
+		Edges:      make([]ReciprocityEdge, 0),
+		Pairs:      make([]ReciprocityPair, 0),
+		Blocs:      make([][]string, 0),
+		Iterations: iterations,
+		Alpha:      alpha,
+	}
+
+	flagged := make(map[string][]string)
+
+	for a := 0; a < len(members); a++ {
+		for b := a + 1; b < len(members); b++ {
+			key := [2]string{members[a], members[b]}
+			pair := ReciprocityPair{
+				MemberA: members[a],
+				MemberB: members[b],
+				AToB:    observed[members[a]][members[b]],
+				BToA:    observed[members[b]][members[a]],
+				Mutual:  mutualSupport(observed, members[a], members[b]),
+				History: make([]ReciprocityRound, 0),
+			}
+			if pair.AToB == 0 && pair.BToA == 0 {
+				continue
+			}
+
+			if iterations > 0 {
+				pair.Expected = expected[key] / float64(iterations)
+				// Add-one smoothing keeps the p-value honest for small iteration counts.
+				pair.PValue = float64(exceeded[key]+1) / float64(iterations+1)
+				pair.Flagged = pair.Mutual > 0 && pair.PValue < alpha
+			}
+
+			for _, round := range rounds {
+				aToB, bToA := round.ballots[members[a]][members[b]], round.ballots[members[b]][members[a]]
+				if aToB != 0 || bToA != 0 {
+					pair.History = append(pair.History, ReciprocityRound{RoundId: round.id, AToB: aToB, BToA: bToA})
+				}
+			}
+
+			if pair.Flagged {
+				flagged[members[a]] = append(flagged[members[a]], members[b])
+				flagged[members[b]] = append(flagged[members[b]], members[a])
+			}
+
+			graph.Pairs = append(graph.Pairs, pair)
+		}
+	}
+
+	sort.SliceStable(graph.Pairs, func(i, j int) bool {
+		return graph.Pairs[i].PValue < graph.Pairs[j].PValue
+	})
+
+	graph.Blocs = findBlocs(flagged)
+
+	for _, memberId := range members {
+		node := ReciprocityNode{}
+		if node.Member, err = GetMemberById(ctx, memberId); err != nil {
+			return ReciprocityGraph{}, err
+		}
+
+		for _, otherId := range members {
+			node.PointsGiven += observed[memberId][otherId]
+			node.PointsReceived += observed[otherId][memberId]
+
+			if weight := observed[memberId][otherId]; weight != 0 {
+				graph.Edges = append(graph.Edges, ReciprocityEdge{Source: memberId, Target: otherId, Weight: weight})
+			}
+		}
+
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	return graph, nil
+}
+
+func loadReciprocityRounds(ctx context.Context, leagueId string) ([]reciprocityRound, error) {
+	rows, err := DB.QueryContext(ctx, "SELECT DISTINCT round_id, submitter_id FROM submissions JOIN rounds ON submissions.round_id = rounds.id WHERE submissions.league_id = ? ORDER BY sequence, round_id, submitter_id", leagueId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rounds := make([]reciprocityRound, 0)
+	index := make(map[string]int)
+
+	for rows.Next() {
+		var roundId, submitterId string
+		if err = rows.Scan(&roundId, &submitterId); err != nil {
+			return nil, err
+		}
+
+		if _, exists := index[roundId]; !exists {
+			index[roundId] = len(rounds)
+			rounds = append(rounds, reciprocityRound{id: roundId, ballots: make(map[string]map[string]int)})
+		}
+		rounds[index[roundId]].submitters = append(rounds[index[roundId]].submitters, submitterId)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	voteRows, err := DB.QueryContext(ctx, "SELECT round_id, voter_id, recipient_id, votes FROM results WHERE league_id = ?", leagueId)
+	if err != nil {
+		return nil, err
+	}
+	defer voteRows.Close()
+
+	for voteRows.Next() {
+		var roundId, voterId, recipientId string
+		var votes int
+		if err = voteRows.Scan(&roundId, &voterId, &recipientId, &votes); err != nil {
+			return nil, err
+		}
+
+		i, exists := index[roundId]
+		if !exists || votes == 0 {
+			continue
+		}
+		if rounds[i].ballots[voterId] == nil {
+			rounds[i].ballots[voterId] = make(map[string]int)
+		}
+		rounds[i].ballots[voterId][recipientId] += votes
+	}
+
+	if err = voteRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rounds, nil
+}
+
+func givenTotals(rounds []reciprocityRound) map[string]map[string]int {
+	totals := make(map[string]map[string]int)
+
+	for _, round := range rounds {
+		for voterId, recipients := range round.ballots {
+			if totals[voterId] == nil {
+				totals[voterId] = make(map[string]int)
+			}
+			for recipientId, points := range recipients {
+				totals[voterId][recipientId] += points
+			}
+		}
+	}
+
+	return totals
+}
+
+// shuffleBallots reassigns each voter's points in each round to randomly
+// chosen submitters other than the voter.
+func shuffleBallots(rounds []reciprocityRound, random *rand.Rand) []reciprocityRound {
+	shuffled := make([]reciprocityRound, 0, len(rounds))
+
+	for _, round := range rounds {
+		shuffledRound := reciprocityRound{id: round.id, submitters: round.submitters, ballots: make(map[string]map[string]int)}
+
+		voters := make([]string, 0, len(round.ballots))
+		for voterId := range round.ballots {
+			voters = append(voters, voterId)
+		}
+		sort.Strings(voters)
+
+		for _, voterId := range voters {
+			recipients := make([]string, 0, len(round.submitters))
+			for _, submitterId := range round.submitters {
+				if submitterId != voterId {
+					recipients = append(recipients, submitterId)
+				}
+			}
+
+			allocation := make([]int, len(recipients))
+			i := 0
+			for _, recipientId := range recipients {
+				if points, exists := round.ballots[voterId][recipientId]; exists && i < len(allocation) {
+					allocation[i] = points
+					i++
+				}
+			}
+			random.Shuffle(len(allocation), func(i, j int) {
+				allocation[i], allocation[j] = allocation[j], allocation[i]
+			})
+
+			shuffledRound.ballots[voterId] = make(map[string]int)
+			for i, recipientId := range recipients {
+				if allocation[i] != 0 {
+					shuffledRound.ballots[voterId][recipientId] = allocation[i]
+				}
+			}
+		}
+
+		shuffled = append(shuffled, shuffledRound)
+	}
+
+	return shuffled
+}
+
+func mutualSupport(totals map[string]map[string]int, a, b string) int {
+	if totals[a][b] < totals[b][a] {
+		return totals[a][b]
+	}
+	return totals[b][a]
+}
+
+// findBlocs returns the maximal groups of at least three members in which
+// every pair is flagged, using Bron-Kerbosch with pivoting. Blocs are ordered
+// largest first, then by their members, so the order is the same every run.
+func findBlocs(flagged map[string][]string) [][]string {
+	blocs := make([][]string, 0)
+
+	neighbors := make(map[string]map[string]bool)
+	candidates := make(map[string]bool)
+	for memberId, others := range flagged {
+		neighbors[memberId] = make(map[string]bool)
+		for _, otherId := range others {
+			neighbors[memberId][otherId] = true
+		}
+		candidates[memberId] = true
+	}
+
+	var expand func(clique []string, candidates, excluded map[string]bool)
+	expand = func(clique []string, candidates, excluded map[string]bool) {
+		if len(candidates) == 0 && len(excluded) == 0 {
+			if len(clique) >= 3 {
+				bloc := append([]string{}, clique...)
+				sort.Strings(bloc)
+				blocs = append(blocs, bloc)
+			}
+			return
+		}
+
+		var pivot string
+		for memberId := range candidates {
+			if pivot == "" || len(neighbors[memberId]) > len(neighbors[pivot]) {
+				pivot = memberId
+			}
+		}
+		for memberId := range excluded {
+			if pivot == "" || len(neighbors[memberId]) > len(neighbors[pivot]) {
+				pivot = memberId
+			}
+		}
+
+		for memberId := range candidates {
+			if neighbors[pivot][memberId] {
+				continue
+			}
+
+			nextCandidates := make(map[string]bool)
+			nextExcluded := make(map[string]bool)
+			for otherId := range neighbors[memberId] {
+				if candidates[otherId] {
+					nextCandidates[otherId] = true
+				}
+				if excluded[otherId] {
+					nextExcluded[otherId] = true
+				}
+			}
+
+			expand(append(clique, memberId), nextCandidates, nextExcluded)
+
+			delete(candidates, memberId)
+			excluded[memberId] = true
+		}
+	}
+
+	expand(nil, candidates, make(map[string]bool))
+
+	sort.Slice(blocs, func(i, j int) bool {
+		if len(blocs[i]) != len(blocs[j]) {
+			return len(blocs[i]) > len(blocs[j])
+		}
+		return slices.Compare(blocs[i], blocs[j]) < 0
+	})
+
+	return blocs
+}
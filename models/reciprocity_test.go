@@ -0,0 +1,29 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindBlocsOrder(t *testing.T) {
+	edges := [][2]string{
+		{"a", "d"}, {"a", "e"}, {"d", "e"},
+		{"a", "b"}, {"a", "f"}, {"b", "f"},
+		{"a", "c"}, {"b", "c"},
+		{"g", "h"},
+	}
+	flagged := make(map[string][]string)
+	for _, edge := range edges {
+		flagged[edge[0]] = append(flagged[edge[0]], edge[1])
+		flagged[edge[1]] = append(flagged[edge[1]], edge[0])
+	}
+
+	want := [][]string{{"a", "b", "c"}, {"a", "b", "f"}, {"a", "d", "e"}}
+
+	// Map iteration order changes between runs, so try a few.
+	for i := 0; i < 20; i++ {
+		if got := findBlocs(flagged); !reflect.DeepEqual(got, want) {
+			t.Fatalf("findBlocs = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"context"
+	"sort"
+)
+
+// RoundResult holds the total points each submitter received in a single round.
+type RoundResult struct {
+	RoundId  string
+	Sequence int
+	Points   map[string]int
+}
+
+// Ranking returns the submitters of the round ordered by points, highest first.
+// Ties are broken by member id so the order is stable between calls.
+func (r RoundResult) Ranking() []string {
+	ranking := make([]string, 0, len(r.Points))
+	for memberId := range r.Points {
+		ranking = append(ranking, memberId)
+	}
+
+	sort.Slice(ranking, func(i, j int) bool {
+		if r.Points[ranking[i]] != r.Points[ranking[j]] {
+			return r.Points[ranking[i]] > r.Points[ranking[j]]
+		}
+		return ranking[i] < ranking[j]
+	})
+
+	return ranking
+}
+
+// Placements returns each submitter's placement in the round. Submitters with
+// the same points share a placement, and the next one is placed after all of
+// them, so two members tied for 3rd are followed by 5th.
+func (r RoundResult) Placements() map[string]int {
+	placements := make(map[string]int, len(r.Points))
+	for memberId, points := range r.Points {
+		placements[memberId] = 1
+		for _, other := range r.Points {
+			if other > points {
+				placements[memberId]++
+			}
+		}
+	}
+
+	return placements
+}
+
+// Normalized returns each submitter's points relative to the rest of the
+// round's submitters.
+func (r RoundResult) Normalized() map[string]NormalizedScore {
+	total := 0
+	for _, points := range r.Points {
+		total += points
+	}
+
+	return normalizeScores(r.Points, total)
+}
+
+// GetRoundResult returns the points received by every submitter in a round,
+// including those who received no votes.
+func GetRoundResult(ctx context.Context, roundId string) (_ RoundResult, err error) {
+	ctx, span := startSpan(ctx, "GetRoundResult")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, `SELECT s.submitter_id,
+		COALESCE((SELECT SUM(votes) FROM results WHERE results.round_id = s.round_id AND results.recipient_id = s.submitter_id), 0)
+		FROM (SELECT DISTINCT round_id, submitter_id FROM submissions WHERE round_id = ?) s`, roundId)
+	if err != nil {
+		return RoundResult{}, err
+	}
+	defer rows.Close()
+
+	result := RoundResult{RoundId: roundId, Points: make(map[string]int)}
+
+	for rows.Next() {
+		var submitterId string
+		var points int
+		if err = rows.Scan(&submitterId, &points); err != nil {
+			return RoundResult{}, err
+		}
+		result.Points[submitterId] = points
+	}
+
+	if err = rows.Err(); err != nil {
+		return RoundResult{}, err
+	}
+
+	return result, nil
+}
+
+// GetLeagueRoundResults returns the points received by every submitter in each
+// round of a league, ordered by round sequence. Submitters who received no
+// votes are included with zero points.
+func GetLeagueRoundResults(ctx context.Context, leagueId string) (_ []RoundResult, err error) {
+	ctx, span := startSpan(ctx, "GetLeagueRoundResults")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, `SELECT s.round_id, rounds.sequence, s.submitter_id,
+		COALESCE((SELECT SUM(votes) FROM results WHERE results.round_id = s.round_id AND results.recipient_id = s.submitter_id), 0)
+		FROM (SELECT DISTINCT round_id, submitter_id FROM submissions WHERE league_id = ?) s
+		JOIN rounds ON s.round_id = rounds.id
+		ORDER BY rounds.sequence, s.round_id`, leagueId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]RoundResult, 0)
+
+	for rows.Next() {
+		var roundId, submitterId string
+		var sequence, points int
+		if err = rows.Scan(&roundId, &sequence, &submitterId, &points); err != nil {
+			return nil, err
+		}
+
+		if len(results) == 0 || results[len(results)-1].RoundId != roundId {
+			results = append(results, RoundResult{
+				RoundId:  roundId,
+				Sequence: sequence,
+				Points:   make(map[string]int),
+			})
+		}
+		results[len(results)-1].Points[submitterId] = points
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+type StandingsHistory struct {
+	League  League            `json:"league"`
+	Rounds  []Round           `json:"rounds"`
+	Members []MemberStandings `json:"members"`
+}
+
+type MemberStandings struct {
+	Member Member `json:"member"`
+	// Points holds the member's running total after each round.
+	Points []int `json:"points"`
+}
+
+// GetStandingsHistory returns every member's cumulative points after each
+// round of a league, leaders first.
+func GetStandingsHistory(ctx context.Context, leagueId string) (_ StandingsHistory, err error) {
+	ctx, span := startSpan(ctx, "GetStandingsHistory")
+	defer endSpan(span, &err)
+
+	league, err := GetLeagueById(ctx, leagueId)
+	if err != nil || league.Id == "" {
+		return StandingsHistory{}, err
+	}
+
+	results, err := GetLeagueRoundResults(ctx, leagueId)
+	if err != nil {
+		return StandingsHistory{}, err
+	}
+
+	history := StandingsHistory{
+		League:  league,
+		Rounds:  make([]Round, 0, len(results)),
+		Members: make([]MemberStandings, 0),
+	}
+
+	index := make(map[string]int)
+	for i, result := range results {
+		if err = ctx.Err(); err != nil {
+			return StandingsHistory{}, err
+		}
+
+		round, err := GetRoundById(ctx, result.RoundId)
+		if err != nil {
+			return StandingsHistory{}, err
+		}
+		history.Rounds = append(history.Rounds, round)
+
+		for _, memberId := range result.Ranking() {
+			if _, exists := index[memberId]; !exists {
+				member, err := GetMemberById(ctx, memberId)
+				if err != nil {
+					return StandingsHistory{}, err
+				}
+				index[memberId] = len(history.Members)
+				history.Members = append(history.Members, MemberStandings{Member: member, Points: make([]int, len(results))})
+			}
+		}
+
+		for _, standings := range history.Members {
+			standings.Points[i] = result.Points[standings.Member.Id]
+			if i > 0 {
+				standings.Points[i] += standings.Points[i-1]
+			}
+		}
+	}
+
+	last := len(results) - 1
+	sort.SliceStable(history.Members, func(i, j int) bool {
+		return history.Members[i].Points[last] > history.Members[j].Points[last]
+	})
+
+	return history, nil
+}
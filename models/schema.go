@@ -0,0 +1,306 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+type migration struct {
+	version int
+	name    string
+	// requires names a SQLite compile option the migration depends on. If the
+	// linked SQLite was built without it the migration is skipped, and tried
+	// again on the next start.
+	requires   string
+	statements []string
+}
+
+// migrations are applied in order by Migrate. Never edit or reorder a
+// migration that has been released; add a new one instead.
+var migrations = []migration{
+	{
+		// Full-text index over vote and submission comments. FTS5 is only
+		// compiled into go-sqlite3 with the sqlite_fts5 build tag:
+		//   go build -tags sqlite_fts5
+		version:  1,
+		name:     "comment_search",
+		requires: "ENABLE_FTS5",
+		statements: []string{
+			`CREATE VIRTUAL TABLE comment_search USING fts5(
+				comment,
+				kind UNINDEXED,
+				league_id UNINDEXED,
+				round_id UNINDEXED,
+				author_id UNINDEXED,
+				recipient_id UNINDEXED,
+				track_id UNINDEXED,
+				tokenize = 'unicode61 remove_diacritics 2'
+			)`,
+			`INSERT INTO comment_search(comment, kind, league_id, round_id, author_id, recipient_id, track_id)
+				SELECT comment, 'vote', league_id, round_id, voter_id, recipient_id, track_id FROM results WHERE comment <> ''`,
+			`INSERT INTO comment_search(comment, kind, league_id, round_id, author_id, recipient_id, track_id)
+				SELECT comment, 'submission', league_id, round_id, submitter_id, submitter_id, track_id FROM submissions WHERE comment <> ''`,
+			`CREATE TRIGGER results_comment_search_insert AFTER INSERT ON results WHEN new.comment <> '' BEGIN
+				INSERT INTO comment_search(comment, kind, league_id, round_id, author_id, recipient_id, track_id)
+				VALUES (new.comment, 'vote', new.league_id, new.round_id, new.voter_id, new.recipient_id, new.track_id);
+			END`,
+			`CREATE TRIGGER results_comment_search_delete AFTER DELETE ON results BEGIN
+				DELETE FROM comment_search WHERE kind = 'vote' AND league_id = old.league_id AND round_id = old.round_id
+					AND author_id = old.voter_id AND recipient_id = old.recipient_id;
+			END`,
+			`CREATE TRIGGER results_comment_search_update AFTER UPDATE ON results BEGIN
+				DELETE FROM comment_search WHERE kind = 'vote' AND league_id = old.league_id AND round_id = old.round_id
+					AND author_id = old.voter_id AND recipient_id = old.recipient_id;
+				INSERT INTO comment_search(comment, kind, league_id, round_id, author_id, recipient_id, track_id)
+					SELECT new.comment, 'vote', new.league_id, new.round_id, new.voter_id, new.recipient_id, new.track_id WHERE new.comment <> '';
+			END`,
+			`CREATE TRIGGER submissions_comment_search_insert AFTER INSERT ON submissions WHEN new.comment <> '' BEGIN
+				INSERT INTO comment_search(comment, kind, league_id, round_id, author_id, recipient_id, track_id)
+				VALUES (new.comment, 'submission', new.league_id, new.round_id, new.submitter_id, new.submitter_id, new.track_id);
+			END`,
+			`CREATE TRIGGER submissions_comment_search_delete AFTER DELETE ON submissions BEGIN
+				DELETE FROM comment_search WHERE kind = 'submission' AND league_id = old.league_id AND round_id = old.round_id
+					AND author_id = old.submitter_id AND track_id = old.track_id;
+			END`,
+			`CREATE TRIGGER submissions_comment_search_update AFTER UPDATE ON submissions BEGIN
+				DELETE FROM comment_search WHERE kind = 'submission' AND league_id = old.league_id AND round_id = old.round_id
+					AND author_id = old.submitter_id AND track_id = old.track_id;
+				INSERT INTO comment_search(comment, kind, league_id, round_id, author_id, recipient_id, track_id)
+					SELECT new.comment, 'submission', new.league_id, new.round_id, new.submitter_id, new.submitter_id, new.track_id WHERE new.comment <> '';
+			END`,
+		},
+	},
+	{
+		// Lexicon sentiment score of each vote comment, filled in by
+		// ScoreComments. The scored comment text is kept so edited comments
+		// are rescored.
+		version: 2,
+		name:    "comment_sentiment",
+		statements: []string{
+			`CREATE TABLE comment_sentiment(league_id, round_id, voter_id, recipient_id, comment, score REAL,
+				PRIMARY KEY (league_id, round_id, voter_id, recipient_id))`,
+		},
+	},
+	{
+		// Round metadata, so a round can be looked up before anyone has
+		// voted in it. league_id is backfilled from the round's submissions
+		// or votes.
+		version: 3,
+		name:    "round_details",
+		statements: []string{
+			`ALTER TABLE rounds ADD COLUMN league_id`,
+			`ALTER TABLE rounds ADD COLUMN description`,
+			`ALTER TABLE rounds ADD COLUMN created_at TIMESTAMP`,
+			`ALTER TABLE rounds ADD COLUMN completed_at TIMESTAMP`,
+			`UPDATE rounds SET league_id = COALESCE(
+				(SELECT league_id FROM submissions WHERE round_id = rounds.id LIMIT 1),
+				(SELECT league_id FROM results WHERE round_id = rounds.id LIMIT 1))`,
+		},
+	},
+	{
+		// Explicit league membership and the points each voter may hand out
+		// per round, both checked when votes are written through the API.
+		// Membership is backfilled from everyone who has submitted or voted,
+		// and the budget from the largest ballot cast in the league.
+		version: 4,
+		name:    "league_members",
+		statements: []string{
+			`CREATE TABLE league_members(league_id, member_id, PRIMARY KEY (league_id, member_id))`,
+			`INSERT OR IGNORE INTO league_members(league_id, member_id)
+				SELECT league_id, submitter_id FROM submissions
+				UNION SELECT league_id, voter_id FROM results
+				UNION SELECT league_id, recipient_id FROM results`,
+			`ALTER TABLE leagues ADD COLUMN vote_budget INTEGER`,
+			`UPDATE leagues SET vote_budget = (SELECT MAX(total) FROM
+				(SELECT SUM(votes) AS total FROM results WHERE league_id = leagues.id GROUP BY round_id, voter_id))`,
+		},
+	},
+	{
+		// Record of admin data corrections. The triggers make it append-only,
+		// so entries can't be edited or removed even by the server.
+		version: 5,
+		name:    "audit_log",
+		statements: []string{
+			`CREATE TABLE audit_log(id INTEGER PRIMARY KEY AUTOINCREMENT, actor TEXT NOT NULL, action TEXT NOT NULL,
+				target TEXT NOT NULL, before TEXT, after TEXT, created_at TIMESTAMP NOT NULL)`,
+			`CREATE INDEX audit_log_target ON audit_log(target)`,
+			`CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log BEGIN
+				SELECT RAISE(ABORT, 'audit_log is append-only');
+			END`,
+			`CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log BEGIN
+				SELECT RAISE(ABORT, 'audit_log is append-only');
+			END`,
+		},
+	},
+	{
+		// API keys are stored as SHA-256 hashes, with their scopes and the
+		// leagues they're limited to. Private leagues can only be read with a
+		// key that can use them.
+		version: 6,
+		name:    "api_keys",
+		statements: []string{
+			`CREATE TABLE api_keys(id TEXT PRIMARY KEY, name TEXT NOT NULL UNIQUE, prefix TEXT NOT NULL,
+				hash TEXT NOT NULL UNIQUE, scopes TEXT NOT NULL, created_at TIMESTAMP NOT NULL, revoked_at TIMESTAMP)`,
+			`CREATE TABLE api_key_leagues(key_id TEXT NOT NULL, league_id TEXT NOT NULL, PRIMARY KEY (key_id, league_id))`,
+			`ALTER TABLE leagues ADD COLUMN private INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// Imports write to the database from outside the server, so they
+		// record when they start and finish. The server isn't ready while one
+		// is running.
+		version: 7,
+		name:    "imports",
+		statements: []string{
+			`CREATE TABLE imports(id INTEGER PRIMARY KEY AUTOINCREMENT, started_at TIMESTAMP NOT NULL, finished_at TIMESTAMP)`,
+		},
+	},
+	{
+		// Emoji are now scored where they appear in a comment, so every
+		// comment is scored again by ScoreComments.
+		version: 8,
+		name:    "rescore_sentiment",
+		statements: []string{
+			`DELETE FROM comment_sentiment`,
+		},
+	},
+	{
+		// The name a caller gives for themselves, kept apart from the
+		// credential they used, which is what the actor column records.
+		version: 9,
+		name:    "audit_reported_actor",
+		statements: []string{
+			`ALTER TABLE audit_log ADD COLUMN reported_actor TEXT`,
+		},
+	},
+	{
+		// Keys that can use every league are flagged, rather than being
+		// told apart by having no leagues, which a limited key ends up with
+		// once its leagues are deleted.
+		version: 10,
+		name:    "api_key_all_leagues",
+		statements: []string{
+			`ALTER TABLE api_keys ADD COLUMN all_leagues INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE api_keys SET all_leagues = 1 WHERE NOT EXISTS (SELECT 1 FROM api_key_leagues WHERE key_id = api_keys.id)`,
+		},
+	},
+}
+
+// Migrate brings the database schema up to date, applying each migration that
+// hasn't been applied yet in its own transaction.
+func Migrate(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "Migrate")
+	defer endSpan(span, &err)
+
+	_, err = DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations(version INTEGER PRIMARY KEY, name TEXT, applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		if m.requires != "" {
+			var available bool
+			if err = DB.QueryRowContext(ctx, "SELECT sqlite_compileoption_used(?)", m.requires).Scan(&available); err != nil {
+				return err
+			}
+			if !available {
+				continue
+			}
+		}
+
+		if err = applyMigration(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := DB.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func applyMigration(ctx context.Context, m migration) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.statements {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations(version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// hasMigration reports whether the named migration has been applied, for
+// features that depend on an optional migration.
+func hasMigration(ctx context.Context, name string) (bool, error) {
+	var version int
+	err := DB.QueryRowContext(ctx, "SELECT version FROM schema_migrations WHERE name = ?", name).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PendingMigrations returns the names of the migrations that haven't been
+// applied, leaving out optional ones the linked SQLite can't apply.
+func PendingMigrations(ctx context.Context) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "PendingMigrations")
+	defer endSpan(span, &err)
+
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]string, 0)
+	for _, m := range migrations {
+		if !applied[m.version] && m.requires == "" {
+			pending = append(pending, m.name)
+		}
+	}
+
+	return pending, nil
+}
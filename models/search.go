@@ -0,0 +1,348 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrSearchUnavailable is returned when the comment search index hasn't been
+// created, which happens when the server is built without FTS5 support.
+var ErrSearchUnavailable = errors.New("comment search requires a build with -tags sqlite_fts5")
+
+type CommentSearchFilter struct {
+	LeagueId    string
+	RoundId     string
+	VoterId     string
+	RecipientId string
+	Limit       int
+	Offset      int
+}
+
+type CommentHit struct {
+	Kind      string  `json:"kind"`
+	LeagueId  string  `json:"league_id"`
+	RoundId   string  `json:"round_id"`
+	Author    Member  `json:"author"`
+	Recipient Member  `json:"recipient"`
+	Track     Track   `json:"track"`
+	Comment   string  `json:"comment"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+}
+
+// SearchComments finds vote and submission comments matching every word in
+// query, best matches first. The snippet is HTML, with the comment escaped
+// and matched words wrapped in <mark> tags. For submission comments the
+// author and recipient are both the submitter, so the voter and recipient
+// filters match the submitter.
+func SearchComments(ctx context.Context, query string, filter CommentSearchFilter) (_ []CommentHit, err error) {
+	ctx, span := startSpan(ctx, "SearchComments")
+	defer endSpan(span, &err)
+
+	available, err := hasMigration(ctx, "comment_search")
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, ErrSearchUnavailable
+	}
+
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	rows, err := DB.QueryContext(ctx, `SELECT kind, league_id, round_id, author_id, recipient_id, track_id, comment,
+		snippet(comment_search, 0, char(2), char(3), '…', 16), bm25(comment_search)
+		FROM comment_search
+		WHERE comment_search MATCH ?
+			AND (? = '' OR league_id = ?)
+			AND (? = '' OR round_id = ?)
+			AND (? = '' OR author_id = ?)
+			AND (? = '' OR recipient_id = ?)
+		ORDER BY rank
+		LIMIT ? OFFSET ?`,
+		match,
+		filter.LeagueId, filter.LeagueId,
+		filter.RoundId, filter.RoundId,
+		filter.VoterId, filter.VoterId,
+		filter.RecipientId, filter.RecipientId,
+		filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]CommentHit, 0)
+
+	for rows.Next() {
+		hit := CommentHit{}
+		var authorId, recipientId, trackId string
+		if err = rows.Scan(&hit.Kind, &hit.LeagueId, &hit.RoundId, &authorId, &recipientId, &trackId, &hit.Comment, &hit.Snippet, &hit.Score); err != nil {
+			return nil, err
+		}
+		// bm25 scores are negative, with the best match the most negative.
+		hit.Score = -hit.Score
+		hit.Snippet = highlight(hit.Snippet)
+
+		if hit.Author, err = GetMemberById(ctx, authorId); err != nil {
+			return nil, err
+		}
+		if hit.Recipient, err = GetMemberById(ctx, recipientId); err != nil {
+			return nil, err
+		}
+		if hit.Track, err = GetTrackById(ctx, trackId); err != nil {
+			return nil, err
+		}
+
+		hits = append(hits, hit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hits, nil
+}
+
+// snippetMarks turns the control characters FTS5 marks matches with into
+// <mark> tags, once the comment around them has been escaped. Comments are
+// written by members, so they can't be trusted to be HTML.
+var snippetMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+func highlight(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
+
+// ftsQuery quotes each word of a user's query so FTS5 treats it as plain text
+// rather than query syntax, and requires all of them to match.
+func ftsQuery(query string) string {
+	terms := make([]string, 0)
+
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// SearchTypes are the kinds of record Search looks through.
+var SearchTypes = []string{"track", "artist", "member", "round", "league"}
+
+type SearchHit struct {
+	Type    string  `json:"type"`
+	Id      string  `json:"id"`
+	Name    string  `json:"name"`
+	Picture string  `json:"picture,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+// Search finds tracks, artists, members, rounds and leagues by name, best
+// matches first. Matching ignores case and diacritics, treats the query as a
+// prefix for autocomplete, and tolerates small typos in longer words.
+func Search(ctx context.Context, query string, types []string, limit int) (_ []SearchHit, err error) {
+	ctx, span := startSpan(ctx, "Search")
+	defer endSpan(span, &err)
+
+	needle := foldText(query)
+	if needle == "" {
+		return nil, nil
+	}
+
+	wanted := listToSet(types)
+	if len(types) == 0 {
+		wanted = listToSet(SearchTypes)
+	}
+
+	rows, err := DB.QueryContext(ctx, `SELECT 'track', id, name, picture FROM track_names
+		UNION ALL SELECT 'artist', id, name, '' FROM artist
+		UNION ALL SELECT 'member', id, name, picture FROM members
+		UNION ALL SELECT 'round', id, name, '' FROM rounds
+		UNION ALL SELECT 'league', id, name, '' FROM leagues`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+
+	for rows.Next() {
+		hit := SearchHit{}
+		if err = rows.Scan(&hit.Type, &hit.Id, &hit.Name, &hit.Picture); err != nil {
+			return nil, err
+		}
+		if !wanted[hit.Type] {
+			continue
+		}
+
+		if hit.Score = nameMatchScore(needle, foldText(hit.Name)); hit.Score > 0 {
+			hits = append(hits, hit)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if len(hits[i].Name) != len(hits[j].Name) {
+			return len(hits[i].Name) < len(hits[j].Name)
+		}
+		return hits[i].Name < hits[j].Name
+	})
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return hits, nil
+}
+
+// foldText lowercases text, strips diacritics and collapses everything that
+// isn't a letter or digit into single spaces, so "Beyoncé!" becomes "beyonce".
+func foldText(text string) string {
+	decomposed := norm.NFD.String(text)
+
+	var b strings.Builder
+	space := true
+	for _, r := range decomposed {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+			space = false
+		case !space:
+			b.WriteRune(' ')
+			space = true
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// nameMatchScore rates how well a folded name matches a folded query, from 1 for
+// an exact match down to 0 for no match.
+func nameMatchScore(query, name string) float64 {
+	switch {
+	case name == query:
+		return 1
+	case strings.HasPrefix(name, query):
+		return 0.9
+	}
+
+	queryWords := strings.Fields(query)
+	nameWords := strings.Fields(name)
+
+	// Every query word starts a word of the name, in any order.
+	prefixed := true
+	for _, queryWord := range queryWords {
+		found := false
+		for _, nameWord := range nameWords {
+			if strings.HasPrefix(nameWord, queryWord) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			prefixed = false
+			break
+		}
+	}
+	if prefixed {
+		return 0.8
+	}
+
+	if strings.Contains(name, query) {
+		return 0.6
+	}
+
+	// Every query word is within a few typos of the start of a word of the
+	// name. Prefixes one rune shorter and longer than the query word are
+	// tried too, so a dropped or doubled letter costs a single typo.
+	distance := 0
+	for _, queryWord := range queryWords {
+		allowed := typoAllowance(queryWord)
+		best := allowed + 1
+		length := len([]rune(queryWord))
+		for _, nameWord := range nameWords {
+			runes := []rune(nameWord)
+			for n := length - 1; n <= length+1; n++ {
+				if n < 1 || n > len(runes) {
+					continue
+				}
+				if d := editDistance(queryWord, string(runes[:n])); d < best {
+					best = d
+				}
+			}
+		}
+		if best > allowed {
+			return 0
+		}
+		distance += best
+	}
+
+	return math.Max(0.1, 0.5-0.1*float64(distance))
+}
+
+func typoAllowance(word string) int {
+	switch n := len([]rune(word)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// editDistance is the optimal string alignment distance between two strings:
+// the number of insertions, deletions, substitutions and transpositions of
+// adjacent runes needed to turn one into the other.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
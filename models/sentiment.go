@@ -0,0 +1,335 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Submissions need at least this many scored comments to be ranked as most
+// loved or most roasted, so one gushing comment doesn't top the list.
+const minSentimentComments = 2
+
+type MemberSentiment struct {
+	Member        Member  `json:"member"`
+	Given         float64 `json:"given"`
+	GivenCount    int     `json:"given_count"`
+	Received      float64 `json:"received"`
+	ReceivedCount int     `json:"received_count"`
+}
+
+type TrackSentiment struct {
+	Round     Round   `json:"round"`
+	Submitter Member  `json:"submitter"`
+	Track     Track   `json:"track"`
+	Sentiment float64 `json:"sentiment"`
+	Comments  int     `json:"comments"`
+}
+
+type SentimentStats struct {
+	League      League            `json:"league"`
+	Members     []MemberSentiment `json:"members"`
+	Tracks      []TrackSentiment  `json:"tracks"`
+	MostLoved   []TrackSentiment  `json:"most_loved"`
+	MostRoasted []TrackSentiment  `json:"most_roasted"`
+}
+
+// sentimentLexicon rates words and emoji from -4 (scathing) to 4 (glowing),
+// with a bias towards how people talk about music.
+var sentimentLexicon = map[string]float64{
+	"amazing": 3, "awesome": 3, "banger": 3, "bangers": 3, "beautiful": 3, "best": 3,
+	"bop": 3, "brilliant": 3, "masterpiece": 4, "perfect": 3, "incredible": 3, "fantastic": 3,
+	"excellent": 3, "gorgeous": 3, "stunning": 3, "goat": 3, "slaps": 3, "slap": 2,
+	"love": 3, "loved": 3, "loving": 2, "adore": 3, "favorite": 2, "favourite": 2,
+	"fire": 2, "great": 2, "good": 2, "nice": 2, "cool": 1, "fun": 2, "funny": 1,
+	"jam": 2, "vibe": 1, "vibes": 1, "groove": 1, "groovy": 2, "catchy": 2, "chill": 1,
+	"enjoy": 2, "enjoyed": 2, "happy": 2, "glad": 2, "lovely": 2, "sweet": 2, "pretty": 1,
+	"solid": 1, "fresh": 1, "clever": 2, "creative": 2, "unique": 1, "interesting": 1,
+	"impressive": 2, "epic": 3, "legendary": 3, "iconic": 3, "classic": 2, "wow": 2,
+	"yes": 1, "haha": 1, "lol": 1, "lmao": 1, "nostalgia": 1, "nostalgic": 1, "wonderful": 3,
+	"bops": 3, "chef's": 2, "kiss": 1, "underrated": 2, "gem": 3, "smooth": 1, "earworm": 1,
+	"thanks": 1, "thank": 1, "appreciate": 2, "respect": 2, "delight": 3, "delightful": 3,
+	"bad": -2, "worst": -3, "awful": -3, "terrible": -3, "horrible": -3, "hate": -3,
+	"hated": -3, "boring": -2, "bored": -2, "meh": -1, "mid": -1, "skip": -2, "annoying": -2,
+	"overrated": -2, "cringe": -2, "cringey": -2, "weird": -1, "ugh": -2, "yikes": -2,
+	"painful": -2, "pain": -2, "sad": -1, "disappointed": -2, "disappointing": -2, "dull": -2,
+	"generic": -1, "repetitive": -1, "grating": -2, "noise": -1, "trash": -3, "garbage": -3,
+	"sucks": -3, "suck": -2, "lame": -2, "bland": -2, "forgettable": -2, "unlistenable": -3,
+	"sorry": -1, "wrong": -1, "confused": -1, "confusing": -1, "hurts": -2, "ears": -1,
+	"offensive": -2, "dislike": -2, "nope": -2, "why": -1, "tired": -1,
+	"❤": 3, "😍": 3, "🔥": 2, "👏": 2, "🙌": 2, "👑": 2, "✨": 1, "🤌": 2, "🤘": 2,
+	"😂": 1, "🤣": 1, "😊": 2, "🥰": 3, "💯": 2, "👍": 1, "🎉": 2, "🥲": -1, "😢": -1,
+	"😭": -1, "🤮": -3, "👎": -2, "😬": -1, "💀": -1, "🙄": -2, "😴": -2, "😡": -3,
+}
+
+var negators = listToSet([]string{
+	"not", "no", "never", "isn't", "wasn't", "aren't", "don't", "doesn't", "didn't",
+	"can't", "couldn't", "won't", "wouldn't", "hardly", "barely", "without", "nothing",
+})
+
+var intensifiers = map[string]float64{
+	"very": 1.5, "really": 1.5, "so": 1.4, "super": 1.5, "extremely": 1.8, "absolutely": 1.8,
+	"totally": 1.5, "incredibly": 1.8, "such": 1.3, "truly": 1.5, "most": 1.3,
+	"kinda": 0.6, "somewhat": 0.6, "slightly": 0.5, "bit": 0.7, "little": 0.7,
+}
+
+// ScoreSentiment rates the tone of a comment from -1 (negative) to 1
+// (positive). Words and emoji are looked up in a small built-in lexicon; a
+// negation within the three preceding words flips a rating, unless another
+// rated word comes between them, and an intensifier just before it scales it.
+func ScoreSentiment(comment string) float64 {
+	tokens := sentimentTokens(comment)
+
+	var sum float64
+	for i, token := range tokens {
+		valence, rated := sentimentLexicon[baseEmoji(token)]
+		if !rated {
+			continue
+		}
+
+		if i > 0 {
+			if factor, exists := intensifiers[tokens[i-1]]; exists {
+				valence *= factor
+			}
+		}
+		for j := i - 1; j >= 0 && j >= i-3; j-- {
+			if negators[tokens[j]] {
+				valence *= -0.75
+				break
+			}
+			if _, rated := sentimentLexicon[baseEmoji(tokens[j])]; rated {
+				// "not bad 😍" negates bad, not the emoji.
+				break
+			}
+		}
+
+		sum += valence
+	}
+
+	// Squash the sum into (-1, 1) so long comments don't dominate.
+	return sum / math.Sqrt(sum*sum+15)
+}
+
+// sentimentTokens splits a comment into words and emoji in the order they
+// appear, so emoji are negated and intensified by the words just before them.
+func sentimentTokens(comment string) []string {
+	tokens := make([]string, 0)
+	runes := []rune(comment)
+
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !isEmoji(runes[i]) {
+			continue
+		}
+
+		tokens = append(tokens, tokenize(string(runes[start:i]))...)
+		emoji := extractEmoji(string(runes[i:]))[0]
+		tokens = append(tokens, emoji)
+
+		i += len([]rune(emoji)) - 1
+		start = i + 1
+	}
+
+	return append(tokens, tokenize(string(runes[start:]))...)
+}
+
+// baseEmoji strips variation selectors and skin tone modifiers, so 👍🏽 is
+// rated like 👍. Other tokens are returned unchanged.
+func baseEmoji(token string) string {
+	return strings.Map(func(r rune) rune {
+		if r == 0xFE0F || (r >= 0x1F3FB && r <= 0x1F3FF) {
+			return -1
+		}
+		return r
+	}, token)
+}
+
+// ScoreComments scores every vote comment that hasn't been scored since it
+// was last changed, and drops the scores of comments that no longer exist.
+// It returns how many comments were scored.
+func ScoreComments(ctx context.Context) (_ int, err error) {
+	ctx, span := startSpan(ctx, "ScoreComments")
+	defer endSpan(span, &err)
+
+	rows, err := DB.QueryContext(ctx, `SELECT results.league_id, results.round_id, results.voter_id, results.recipient_id, results.comment
+		FROM results LEFT JOIN comment_sentiment s ON s.league_id = results.league_id AND s.round_id = results.round_id
+			AND s.voter_id = results.voter_id AND s.recipient_id = results.recipient_id
+		WHERE results.comment <> '' AND (s.comment IS NULL OR s.comment <> results.comment)`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type pending struct {
+		leagueId, roundId, voterId, recipientId, comment string
+	}
+	comments := make([]pending, 0)
+
+	for rows.Next() {
+		p := pending{}
+		if err = rows.Scan(&p.leagueId, &p.roundId, &p.voterId, &p.recipientId, &p.comment); err != nil {
+			return 0, err
+		}
+		comments = append(comments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, p := range comments {
+		if err = scoreComment(ctx, tx, p.leagueId, p.roundId, p.voterId, p.recipientId, p.comment); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM comment_sentiment WHERE NOT EXISTS (SELECT 1 FROM results r WHERE r.league_id = comment_sentiment.league_id
+		AND r.round_id = comment_sentiment.round_id AND r.voter_id = comment_sentiment.voter_id
+		AND r.recipient_id = comment_sentiment.recipient_id AND r.comment = comment_sentiment.comment)`)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(comments), tx.Commit()
+}
+
+// scoreComment stores the sentiment score of a vote comment.
+func scoreComment(ctx context.Context, tx *sql.Tx, leagueId, roundId, voterId, recipientId, comment string) error {
+	_, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO comment_sentiment(league_id, round_id, voter_id, recipient_id, comment, score) VALUES (?, ?, ?, ?, ?, ?)",
+		leagueId, roundId, voterId, recipientId, comment, ScoreSentiment(comment))
+	return err
+}
+
+// GetSentimentStats summarizes the tone of a league's vote comments: the
+// average sentiment each member gives and receives, the average per
+// submission, and the most loved and most roasted submissions.
+func GetSentimentStats(ctx context.Context, leagueId string, limit int) (_ SentimentStats, err error) {
+	ctx, span := startSpan(ctx, "GetSentimentStats")
+	defer endSpan(span, &err)
+
+	league, err := GetLeagueById(ctx, leagueId)
+	if err != nil || league.Id == "" {
+		return SentimentStats{}, err
+	}
+
+	stats := SentimentStats{
+		League:      league,
+		Members:     make([]MemberSentiment, 0),
+		Tracks:      make([]TrackSentiment, 0),
+		MostLoved:   make([]TrackSentiment, 0),
+		MostRoasted: make([]TrackSentiment, 0),
+	}
+
+	rows, err := DB.QueryContext(ctx, `SELECT s.round_id, s.voter_id, s.recipient_id, r.track_id, s.score
+		FROM comment_sentiment s JOIN results r ON s.league_id = r.league_id AND s.round_id = r.round_id
+			AND s.voter_id = r.voter_id AND s.recipient_id = r.recipient_id
+		WHERE s.league_id = ?`, leagueId)
+	if err != nil {
+		return SentimentStats{}, err
+	}
+	defer rows.Close()
+
+	type trackKey struct {
+		roundId, submitterId, trackId string
+	}
+
+	members := make(map[string]*MemberSentiment)
+	tracks := make(map[trackKey]*TrackSentiment)
+
+	member := func(memberId string) *MemberSentiment {
+		if members[memberId] == nil {
+			members[memberId] = &MemberSentiment{Member: Member{Id: memberId}}
+		}
+		return members[memberId]
+	}
+
+	for rows.Next() {
+		var key trackKey
+		var voterId string
+		var score float64
+		if err = rows.Scan(&key.roundId, &voterId, &key.submitterId, &key.trackId, &score); err != nil {
+			return SentimentStats{}, err
+		}
+
+		member(voterId).Given += score
+		member(voterId).GivenCount++
+		member(key.submitterId).Received += score
+		member(key.submitterId).ReceivedCount++
+
+		if tracks[key] == nil {
+			tracks[key] = &TrackSentiment{
+				Round:     Round{Id: key.roundId},
+				Submitter: Member{Id: key.submitterId},
+				Track:     Track{Id: key.trackId},
+			}
+		}
+		tracks[key].Sentiment += score
+		tracks[key].Comments++
+	}
+
+	if err = rows.Err(); err != nil {
+		return SentimentStats{}, err
+	}
+
+	for _, m := range members {
+		if m.GivenCount > 0 {
+			m.Given /= float64(m.GivenCount)
+		}
+		if m.ReceivedCount > 0 {
+			m.Received /= float64(m.ReceivedCount)
+		}
+		if m.Member, err = GetMemberById(ctx, m.Member.Id); err != nil {
+			return SentimentStats{}, err
+		}
+		stats.Members = append(stats.Members, *m)
+	}
+
+	sort.Slice(stats.Members, func(i, j int) bool {
+		if stats.Members[i].Given != stats.Members[j].Given {
+			return stats.Members[i].Given > stats.Members[j].Given
+		}
+		return stats.Members[i].Member.Id < stats.Members[j].Member.Id
+	})
+
+	for _, t := range tracks {
+		t.Sentiment /= float64(t.Comments)
+		if t.Round, err = GetRoundById(ctx, t.Round.Id); err != nil {
+			return SentimentStats{}, err
+		}
+		if t.Submitter, err = GetMemberById(ctx, t.Submitter.Id); err != nil {
+			return SentimentStats{}, err
+		}
+		if t.Track, err = GetTrackById(ctx, t.Track.Id); err != nil {
+			return SentimentStats{}, err
+		}
+		stats.Tracks = append(stats.Tracks, *t)
+	}
+
+	sort.Slice(stats.Tracks, func(i, j int) bool {
+		if stats.Tracks[i].Sentiment != stats.Tracks[j].Sentiment {
+			return stats.Tracks[i].Sentiment > stats.Tracks[j].Sentiment
+		}
+		return stats.Tracks[i].Track.Id < stats.Tracks[j].Track.Id
+	})
+
+	for _, t := range stats.Tracks {
+		if t.Comments >= minSentimentComments && len(stats.MostLoved) < limit {
+			stats.MostLoved = append(stats.MostLoved, t)
+		}
+	}
+	for i := len(stats.Tracks) - 1; i >= 0; i-- {
+		if stats.Tracks[i].Comments >= minSentimentComments && len(stats.MostRoasted) < limit {
+			stats.MostRoasted = append(stats.MostRoasted, stats.Tracks[i])
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+)
+
+// statement is a query that runs on most requests, so it's prepared once by
+// PrepareStatements instead of on every call.
+type statement struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+var statements []*statement
+
+// database/sql prepares a statement again on each connection it's run on.
+// These count how often it had been prepared there already.
+var statementHits, statementMisses atomic.Uint64
+
+func prepared(query string) *statement {
+	s := &statement{query: query}
+	statements = append(statements, s)
+	return s
+}
+
+var (
+	leagueByIdStmt = prepared("SELECT id, name, vote_budget, private FROM leagues WHERE id = ?")
+	memberByIdStmt = prepared("SELECT id, name, picture FROM members WHERE id = ?")
+	roundByIdStmt  = prepared(`SELECT id, name, sequence, COALESCE(description, ''), COALESCE(league_id, ''), created_at, completed_at,
+		COALESCE((SELECT SUM(votes) FROM results WHERE round_id = rounds.id), 0),
+		(SELECT COUNT(*) FROM submissions WHERE round_id = rounds.id),
+		(SELECT COUNT(DISTINCT submitter_id) FROM submissions WHERE round_id = rounds.id),
+		(SELECT COUNT(DISTINCT voter_id) FROM results WHERE round_id = rounds.id)
+		FROM rounds WHERE id = ?`)
+	roundWinnersStmt = prepared(`SELECT recipient_id FROM results WHERE round_id = ? GROUP BY recipient_id
+		HAVING SUM(votes) = (SELECT MAX(points) FROM (SELECT SUM(votes) AS points FROM results WHERE round_id = ? GROUP BY recipient_id))
+		ORDER BY recipient_id`)
+	trackByIdStmt    = prepared("SELECT id, name, COALESCE(album, ''), picture FROM track_names WHERE id = ?")
+	trackArtistsStmt = prepared("SELECT id, name, popularity, followers FROM artist JOIN track_artists ON track_artists.artist_id = artist.id WHERE track_id = ?")
+
+	apiKeyByHashStmt  = prepared("SELECT id, name, prefix, scopes, all_leagues, created_at FROM api_keys WHERE hash = ? AND revoked_at IS NULL")
+	apiKeyLeaguesStmt = prepared("SELECT league_id FROM api_key_leagues WHERE key_id = ?")
+	leaguePrivateStmt = prepared("SELECT private FROM leagues WHERE id = ?")
+	roundLeagueStmt   = prepared("SELECT league_id FROM rounds WHERE id = ?")
+)
+
+// PrepareStatements prepares the queries that run on most requests. It has
+// to be called after Migrate, since they depend on the current schema.
+func PrepareStatements(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "PrepareStatements")
+	defer endSpan(span, &err)
+
+	for _, s := range statements {
+		stmt, err := DB.PrepareContext(ctx, s.query)
+		if err != nil {
+			closeStatements()
+			return err
+		}
+		s.stmt = stmt
+	}
+
+	return nil
+}
+
+// StatementCacheStats returns how many times a prepared statement was run on
+// a connection it had already been prepared on, and how many times it had to
+// be prepared first.
+func StatementCacheStats() (hits, misses uint64) {
+	return statementHits.Load(), statementMisses.Load()
+}
+
+func isStatement(query string) bool {
+	for _, s := range statements {
+		if s.query == query {
+			return true
+		}
+	}
+
+	return false
+}
+
+func closeStatements() {
+	for _, s := range statements {
+		if s.stmt != nil {
+			s.stmt.Close()
+			s.stmt = nil
+		}
+	}
+}
+
+func (s *statement) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	return s.stmt.QueryContext(ctx, args...)
+}
+
+func (s *statement) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
+	return s.stmt.QueryRowContext(ctx, args...)
+}
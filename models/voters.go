@@ -0,0 +1,247 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+type VoterProfile struct {
+	Member               Member  `json:"member"`
+	League               *League `json:"league,omitempty"`
+	Rounds               int     `json:"rounds"`
+	Votes                int     `json:"votes"`
+	PointsGiven          int     `json:"points_given"`
+	AveragePointsPerVote float64 `json:"average_points_per_vote"`
+	Gini                 float64 `json:"gini"`
+	Entropy              float64 `json:"entropy"`
+	DownvoteRate         float64 `json:"downvote_rate"`
+	KingmakerRate        float64 `json:"kingmaker_rate"`
+	CommentRate          float64 `json:"comment_rate"`
+}
+
+type ballot struct {
+	roundId string
+	points  map[string]int
+}
+
+// GetVoterProfile describes how a member votes within a single league.
+func GetVoterProfile(ctx context.Context, leagueId string, memberId string) (_ VoterProfile, err error) {
+	ctx, span := startSpan(ctx, "GetVoterProfile")
+	defer endSpan(span, &err)
+
+	league, err := GetLeagueById(ctx, leagueId)
+	if err != nil || league.Id == "" {
+		return VoterProfile{}, err
+	}
+
+	profile, err := buildVoterProfile(ctx, memberId, "WHERE voter_id = ? AND league_id = ?", memberId, leagueId)
+	if err != nil {
+		return VoterProfile{}, err
+	}
+	profile.League = &league
+
+	return profile, nil
+}
+
+// GetMemberVoterProfile describes how a member votes across every league.
+func GetMemberVoterProfile(ctx context.Context, memberId string) (_ VoterProfile, err error) {
+	ctx, span := startSpan(ctx, "GetMemberVoterProfile")
+	defer endSpan(span, &err)
+
+	return buildVoterProfile(ctx, memberId, "WHERE voter_id = ?", memberId)
+}
+
+func buildVoterProfile(ctx context.Context, memberId string, where string, args ...any) (VoterProfile, error) {
+	member, err := GetMemberById(ctx, memberId)
+	if err != nil || member.Id == "" {
+		return VoterProfile{}, err
+	}
+
+	profile := VoterProfile{Member: member}
+
+	rows, err := DB.QueryContext(ctx, "SELECT round_id, recipient_id, votes, comment FROM results "+where+" ORDER BY round_id", args...)
+	if err != nil {
+		return VoterProfile{}, err
+	}
+	defer rows.Close()
+
+	ballots := make([]ballot, 0)
+	var entries, comments, downvotes int
+
+	for rows.Next() {
+		var roundId, recipientId, comment string
+		var votes int
+		if err = rows.Scan(&roundId, &recipientId, &votes, &comment); err != nil {
+			return VoterProfile{}, err
+		}
+
+		if len(ballots) == 0 || ballots[len(ballots)-1].roundId != roundId {
+			ballots = append(ballots, ballot{roundId: roundId, points: make(map[string]int)})
+		}
+		ballots[len(ballots)-1].points[recipientId] += votes
+
+		entries++
+		if comment != "" {
+			comments++
+		}
+		if votes != 0 {
+			profile.Votes++
+			profile.PointsGiven += votes
+		}
+		if votes < 0 {
+			downvotes++
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return VoterProfile{}, err
+	}
+
+	profile.Rounds = len(ballots)
+	if profile.Votes > 0 {
+		profile.AveragePointsPerVote = float64(profile.PointsGiven) / float64(profile.Votes)
+		profile.DownvoteRate = float64(downvotes) / float64(profile.Votes)
+	}
+	if entries > 0 {
+		profile.CommentRate = float64(comments) / float64(entries)
+	}
+	if len(ballots) == 0 {
+		return profile, nil
+	}
+
+	winners, err := getRoundWinners(ctx)
+	if err != nil {
+		return VoterProfile{}, err
+	}
+
+	var kingmade int
+	for _, b := range ballots {
+		eligible, err := getRoundSubmitters(ctx, b.roundId)
+		if err != nil {
+			return VoterProfile{}, err
+		}
+
+		allocation := make([]float64, 0, len(eligible))
+		for _, submitterId := range eligible {
+			if submitterId != memberId {
+				allocation = append(allocation, float64(b.points[submitterId]))
+			}
+		}
+		profile.Gini += gini(allocation)
+		profile.Entropy += normalizedEntropy(allocation)
+
+		for _, winnerId := range winners[b.roundId] {
+			if b.points[winnerId] > 0 {
+				kingmade++
+				break
+			}
+		}
+	}
+
+	profile.Gini /= float64(len(ballots))
+	profile.Entropy /= float64(len(ballots))
+	profile.KingmakerRate = float64(kingmade) / float64(len(ballots))
+
+	return profile, nil
+}
+
+// getRoundWinners returns the members with the most points in each round,
+// keyed by round id. Tied rounds have more than one winner.
+func getRoundWinners(ctx context.Context) (map[string][]string, error) {
+	rows, err := DB.QueryContext(ctx, "SELECT round_id, recipient_id FROM (SELECT round_id, recipient_id, SUM(votes) AS points, MAX(SUM(votes)) OVER (PARTITION BY round_id) AS best FROM results GROUP BY round_id, recipient_id) WHERE points = best")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	winners := make(map[string][]string)
+
+	for rows.Next() {
+		var roundId, memberId string
+		if err = rows.Scan(&roundId, &memberId); err != nil {
+			return nil, err
+		}
+		winners[roundId] = append(winners[roundId], memberId)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return winners, nil
+}
+
+func getRoundSubmitters(ctx context.Context, roundId string) ([]string, error) {
+	rows, err := DB.QueryContext(ctx, "SELECT DISTINCT submitter_id FROM submissions WHERE round_id = ?", roundId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	submitters := make([]string, 0)
+
+	for rows.Next() {
+		var submitterId string
+		if err = rows.Scan(&submitterId); err != nil {
+			return nil, err
+		}
+		submitters = append(submitters, submitterId)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return submitters, nil
+}
+
+// gini returns the Gini coefficient of the positive points in an allocation:
+// 0 when points are spread evenly over every option, approaching 1 when they
+// all go to one.
+func gini(allocation []float64) float64 {
+	values := make([]float64, 0, len(allocation))
+	var sum float64
+	for _, value := range allocation {
+		value = math.Max(0, value)
+		values = append(values, value)
+		sum += value
+	}
+
+	if len(values) < 2 || sum == 0 {
+		return 0
+	}
+
+	sort.Float64s(values)
+
+	var weighted float64
+	for i, value := range values {
+		weighted += float64(i+1) * value
+	}
+
+	n := float64(len(values))
+	return (2*weighted)/(n*sum) - (n+1)/n
+}
+
+// normalizedEntropy returns the Shannon entropy of the positive points in an
+// allocation divided by the maximum possible, so 1 means perfectly even.
+func normalizedEntropy(allocation []float64) float64 {
+	var sum float64
+	for _, value := range allocation {
+		sum += math.Max(0, value)
+	}
+
+	if len(allocation) < 2 || sum == 0 {
+		return 0
+	}
+
+	var entropy float64
+	for _, value := range allocation {
+		if value > 0 {
+			p := value / sum
+			entropy -= p * math.Log(p)
+		}
+	}
+
+	return entropy / math.Log(float64(len(allocation)))
+}
@@ -0,0 +1,597 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Members need to have taken part in at least this many rounds to be named
+// most consistent.
+const minConsistentRounds = 3
+
+type Superlative struct {
+	Title  string  `json:"title"`
+	Member *Member `json:"member,omitempty"`
+	Round  *Round  `json:"round,omitempty"`
+	Track  *Track  `json:"track,omitempty"`
+	Artist *Artist `json:"artist,omitempty"`
+	Value  float64 `json:"value"`
+	Detail string  `json:"detail"`
+}
+
+type RoundPlacement struct {
+	Round      Round   `json:"round"`
+	Points     int     `json:"points"`
+	Placement  int     `json:"placement"`
+	Percentile float64 `json:"percentile"`
+}
+
+type SubmissionPoints struct {
+	Round  Round `json:"round"`
+	Track  Track `json:"track"`
+	Points int   `json:"points"`
+}
+
+type MemberWrapped struct {
+	League           League            `json:"league"`
+	Member           Member            `json:"member"`
+	Rounds           int               `json:"rounds"`
+	Points           int               `json:"points"`
+	Wins             int               `json:"wins"`
+	AveragePlacement float64           `json:"average_placement"`
+	BestRound        *RoundPlacement   `json:"best_round,omitempty"`
+	WorstRound       *RoundPlacement   `json:"worst_round,omitempty"`
+	TopSubmission    *SubmissionPoints `json:"top_submission,omitempty"`
+	FavoriteArtist   *ArtistCount      `json:"favorite_artist,omitempty"`
+	BiggestFan       *Standing         `json:"biggest_fan,omitempty"`
+	FavoriteMember   *Standing         `json:"favorite_member,omitempty"`
+	// Rating is the member's Elo rating from this league's rounds alone.
+	Rating float64 `json:"rating"`
+}
+
+type LeagueWrapped struct {
+	League       LeagueSummary   `json:"league"`
+	Superlatives []Superlative   `json:"superlatives"`
+	Members      []MemberWrapped `json:"members"`
+}
+
+type wrappedData struct {
+	league   LeagueSummary
+	history  leagueHistory
+	results  map[string]RoundResult
+	rounds   map[string]Round
+	members  map[string]Member
+	artists  map[string][]Artist // track -> artists
+	ratings  map[string]float64
+	memberId []string
+}
+
+// GetLeagueWrapped builds an end-of-season recap of a league: superlatives
+// for the league as a whole and a recap for every member.
+func GetLeagueWrapped(ctx context.Context, leagueId string) (_ LeagueWrapped, err error) {
+	ctx, span := startSpan(ctx, "GetLeagueWrapped")
+	defer endSpan(span, &err)
+
+	data, err := loadWrappedData(ctx, leagueId)
+	if err != nil || data.league.Id == "" {
+		return LeagueWrapped{}, err
+	}
+
+	wrapped := LeagueWrapped{
+		League:       data.league,
+		Superlatives: make([]Superlative, 0),
+		Members:      make([]MemberWrapped, 0, len(data.memberId)),
+	}
+
+	for _, find := range []func(context.Context) (*Superlative, error){
+		data.mostConsistent,
+		data.biggestUpset,
+		data.bestComeback,
+		data.mostGenerous,
+		data.mostPolarizing,
+		data.favoriteArtist,
+	} {
+		superlative, err := find(ctx)
+		if err != nil {
+			return LeagueWrapped{}, err
+		}
+		if superlative != nil {
+			wrapped.Superlatives = append(wrapped.Superlatives, *superlative)
+		}
+	}
+
+	for _, memberId := range data.memberId {
+		member, err := data.memberWrapped(ctx, memberId)
+		if err != nil {
+			return LeagueWrapped{}, err
+		}
+		wrapped.Members = append(wrapped.Members, member)
+	}
+
+	sort.SliceStable(wrapped.Members, func(i, j int) bool {
+		return wrapped.Members[i].Points > wrapped.Members[j].Points
+	})
+
+	return wrapped, nil
+}
+
+// GetMemberWrapped builds the end-of-season recap of one member in a league.
+func GetMemberWrapped(ctx context.Context, leagueId string, memberId string) (_ MemberWrapped, err error) {
+	ctx, span := startSpan(ctx, "GetMemberWrapped")
+	defer endSpan(span, &err)
+
+	data, err := loadWrappedData(ctx, leagueId)
+	if err != nil || data.league.Id == "" {
+		return MemberWrapped{}, err
+	}
+
+	if _, exists := data.members[memberId]; !exists {
+		return MemberWrapped{}, nil
+	}
+
+	return data.memberWrapped(ctx, memberId)
+}
+
+func loadWrappedData(ctx context.Context, leagueId string) (*wrappedData, error) {
+	league, err := GetLeagueSummary(ctx, leagueId)
+	if err != nil || league.Id == "" {
+		return &wrappedData{}, err
+	}
+
+	data := &wrappedData{
+		league:  league,
+		results: make(map[string]RoundResult),
+		rounds:  make(map[string]Round),
+		members: make(map[string]Member),
+		artists: make(map[string][]Artist),
+		ratings: make(map[string]float64),
+	}
+
+	if data.history, err = loadLeagueHistory(ctx, leagueId); err != nil {
+		return nil, err
+	}
+
+	results, err := GetLeagueRoundResults(ctx, leagueId)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		data.results[result.RoundId] = result
+	}
+
+	for _, round := range data.history.rounds {
+		if data.rounds[round.id], err = GetRoundById(ctx, round.id); err != nil {
+			return nil, err
+		}
+
+		for submitterId, trackId := range round.submissions {
+			if _, exists := data.members[submitterId]; !exists {
+				if data.members[submitterId], err = GetMemberById(ctx, submitterId); err != nil {
+					return nil, err
+				}
+				data.memberId = append(data.memberId, submitterId)
+			}
+			if _, exists := data.artists[trackId]; !exists {
+				if data.artists[trackId], err = GetTrackArtists(ctx, trackId); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	sort.Strings(data.memberId)
+
+	ratings, err := computeRatings(ctx, []League{league.League})
+	if err != nil {
+		return nil, err
+	}
+	data.ratings = ratings.ratings
+
+	return data, nil
+}
+
+func (d *wrappedData) track(ctx context.Context, trackId string) (*Track, error) {
+	track, err := GetTrackById(ctx, trackId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &track, nil
+}
+
+func (d *wrappedData) member(memberId string) *Member {
+	member := d.members[memberId]
+	return &member
+}
+
+func (d *wrappedData) round(roundId string) *Round {
+	round := d.rounds[roundId]
+	return &round
+}
+
+// placements returns each member's placement and percentile in a round.
+func (d *wrappedData) placements(roundId string) (map[string]int, map[string]NormalizedScore) {
+	result := d.results[roundId]
+	return result.Placements(), result.Normalized()
+}
+
+func (d *wrappedData) mostConsistent(ctx context.Context) (*Superlative, error) {
+	best, bestDeviation := "", math.Inf(1)
+
+	for _, memberId := range d.memberId {
+		percentiles := make([]float64, 0)
+		for _, round := range d.history.rounds {
+			if _, played := d.results[round.id].Points[memberId]; played {
+				_, scores := d.placements(round.id)
+				percentiles = append(percentiles, scores[memberId].Percentile)
+			}
+		}
+		if len(percentiles) < minConsistentRounds {
+			continue
+		}
+
+		average := mean(percentiles)
+		var variance float64
+		for _, p := range percentiles {
+			variance += (p - average) * (p - average)
+		}
+		deviation := math.Sqrt(variance / float64(len(percentiles)))
+
+		if deviation < bestDeviation {
+			best, bestDeviation = memberId, deviation
+		}
+	}
+
+	if best == "" {
+		return nil, nil
+	}
+
+	return &Superlative{
+		Title:  "Most Consistent",
+		Member: d.member(best),
+		Value:  bestDeviation,
+		Detail: fmt.Sprintf("Their percentile placement varied by only %.0f points from round to round", bestDeviation*100),
+	}, nil
+}
+
+func (d *wrappedData) biggestUpset(ctx context.Context) (*Superlative, error) {
+	var upset *Superlative
+	bestGain := 0
+
+	for i := 1; i < len(d.history.rounds); i++ {
+		round := d.history.rounds[i]
+		predictions, err := newPredictor(d.history, d.history.rounds[:i]).predict(ctx, round)
+		if err != nil {
+			return nil, err
+		}
+
+		placements, _ := d.placements(round.id)
+		for _, prediction := range predictions {
+			placement, played := placements[prediction.Submitter.Id]
+			if !played {
+				continue
+			}
+
+			if gain := prediction.PredictedRank - placement; gain > bestGain {
+				bestGain = gain
+				track := prediction.Track
+				upset = &Superlative{
+					Title:  "Biggest Upset",
+					Member: d.member(prediction.Submitter.Id),
+					Round:  d.round(round.id),
+					Track:  &track,
+					Value:  float64(gain),
+					Detail: fmt.Sprintf("Predicted to finish %s in %s but placed %s", Ordinal(prediction.PredictedRank), d.rounds[round.id].Name, Ordinal(placement)),
+				}
+			}
+		}
+	}
+
+	return upset, nil
+}
+
+func (d *wrappedData) bestComeback(ctx context.Context) (*Superlative, error) {
+	var comeback *Superlative
+	bestJump := 0.0
+
+	for _, memberId := range d.memberId {
+		previous := ""
+		for _, round := range d.history.rounds {
+			if _, played := d.results[round.id].Points[memberId]; !played {
+				continue
+			}
+
+			if previous != "" {
+				beforePlacements, before := d.placements(previous)
+				afterPlacements, after := d.placements(round.id)
+				if jump := after[memberId].Percentile - before[memberId].Percentile; jump > bestJump {
+					bestJump = jump
+					comeback = &Superlative{
+						Title:  "Best Comeback",
+						Member: d.member(memberId),
+						Round:  d.round(round.id),
+						Value:  jump,
+						Detail: fmt.Sprintf("Went from %s in %s to %s in %s",
+							Ordinal(beforePlacements[memberId]), d.rounds[previous].Name,
+							Ordinal(afterPlacements[memberId]), d.rounds[round.id].Name),
+					}
+				}
+			}
+			previous = round.id
+		}
+	}
+
+	return comeback, nil
+}
+
+// mostGenerous finds the voter who spread their points over the most
+// submissions per round.
+func (d *wrappedData) mostGenerous(ctx context.Context) (*Superlative, error) {
+	recipients := make(map[string]int)
+	ballots := make(map[string]int)
+
+	for _, round := range d.history.rounds {
+		for voterId, votes := range round.votes {
+			ballots[voterId]++
+			for _, points := range votes {
+				if points > 0 {
+					recipients[voterId]++
+				}
+			}
+		}
+	}
+
+	best, bestSpread := "", 0.0
+	for _, memberId := range d.memberId {
+		if ballots[memberId] == 0 {
+			continue
+		}
+		if spread := float64(recipients[memberId]) / float64(ballots[memberId]); spread > bestSpread {
+			best, bestSpread = memberId, spread
+		}
+	}
+
+	if best == "" {
+		return nil, nil
+	}
+
+	return &Superlative{
+		Title:  "Most Generous Voter",
+		Member: d.member(best),
+		Value:  bestSpread,
+		Detail: fmt.Sprintf("Gave points to %.1f submissions per round on average", bestSpread),
+	}, nil
+}
+
+// mostPolarizing finds the submission whose voters disagreed the most, by the
+// variance of the points each eligible voter gave it.
+func (d *wrappedData) mostPolarizing(ctx context.Context) (*Superlative, error) {
+	var polarizing *Superlative
+	bestVariance := 0.0
+
+	for _, round := range d.history.rounds {
+		for _, submitterId := range round.submitters() {
+			points := make([]float64, 0)
+			for _, voterId := range round.voters() {
+				if voterId != submitterId {
+					points = append(points, float64(round.votes[voterId][submitterId]))
+				}
+			}
+			if len(points) < 2 {
+				continue
+			}
+
+			average := mean(points)
+			var variance float64
+			for _, p := range points {
+				variance += (p - average) * (p - average)
+			}
+			variance /= float64(len(points))
+
+			if variance > bestVariance {
+				track, err := d.track(ctx, round.submissions[submitterId])
+				if err != nil {
+					return nil, err
+				}
+
+				bestVariance = variance
+				polarizing = &Superlative{
+					Title:  "Most Polarizing Submission",
+					Member: d.member(submitterId),
+					Round:  d.round(round.id),
+					Track:  track,
+					Value:  variance,
+					Detail: fmt.Sprintf("Points from each voter varied by %.1f on average", math.Sqrt(variance)),
+				}
+			}
+		}
+	}
+
+	return polarizing, nil
+}
+
+func (d *wrappedData) favoriteArtist(ctx context.Context) (*Superlative, error) {
+	counts := make(map[string]int)
+	points := make(map[string]int)
+	artists := make(map[string]Artist)
+
+	for _, round := range d.history.rounds {
+		for submitterId, trackId := range round.submissions {
+			for _, artist := range d.artists[trackId] {
+				artists[artist.Id] = artist
+				counts[artist.Id]++
+				points[artist.Id] += d.results[round.id].Points[submitterId]
+			}
+		}
+	}
+
+	best := ""
+	for artistId := range counts {
+		if best == "" || counts[artistId] > counts[best] ||
+			(counts[artistId] == counts[best] && (points[artistId] > points[best] || (points[artistId] == points[best] && artistId < best))) {
+			best = artistId
+		}
+	}
+
+	if best == "" {
+		return nil, nil
+	}
+
+	artist := artists[best]
+	return &Superlative{
+		Title:  "Favorite Artist",
+		Artist: &artist,
+		Value:  float64(counts[best]),
+		Detail: fmt.Sprintf("Submitted %s for a total of %d points", times(counts[best]), points[best]),
+	}, nil
+}
+
+func (d *wrappedData) memberWrapped(ctx context.Context, memberId string) (MemberWrapped, error) {
+	wrapped := MemberWrapped{
+		League: d.league.League,
+		Member: d.members[memberId],
+		Rating: d.ratings[memberId],
+	}
+
+	given := make(map[string]int)
+	received := make(map[string]int)
+	artistCounts := make(map[string]int)
+	artistPoints := make(map[string]int)
+	artists := make(map[string]Artist)
+	var placementSum int
+
+	for _, round := range d.history.rounds {
+		for voterId, votes := range round.votes {
+			if voterId == memberId {
+				for recipientId, points := range votes {
+					given[recipientId] += points
+				}
+			} else if points := votes[memberId]; points != 0 {
+				received[voterId] += points
+			}
+		}
+
+		points, played := d.results[round.id].Points[memberId]
+		if !played {
+			continue
+		}
+
+		placements, scores := d.placements(round.id)
+		placement := RoundPlacement{
+			Round:      d.rounds[round.id],
+			Points:     points,
+			Placement:  placements[memberId],
+			Percentile: scores[memberId].Percentile,
+		}
+
+		wrapped.Rounds++
+		wrapped.Points += points
+		placementSum += placement.Placement
+		if placement.Placement == 1 {
+			wrapped.Wins++
+		}
+		if wrapped.BestRound == nil || placement.Percentile > wrapped.BestRound.Percentile {
+			best := placement
+			wrapped.BestRound = &best
+		}
+		if wrapped.WorstRound == nil || placement.Percentile < wrapped.WorstRound.Percentile {
+			worst := placement
+			wrapped.WorstRound = &worst
+		}
+
+		trackId := round.submissions[memberId]
+		if wrapped.TopSubmission == nil || points > wrapped.TopSubmission.Points {
+			wrapped.TopSubmission = &SubmissionPoints{Round: d.rounds[round.id], Track: Track{Id: trackId}, Points: points}
+		}
+		for _, artist := range d.artists[trackId] {
+			artists[artist.Id] = artist
+			artistCounts[artist.Id]++
+			artistPoints[artist.Id] += points
+		}
+	}
+
+	if wrapped.Rounds > 0 {
+		wrapped.AveragePlacement = float64(placementSum) / float64(wrapped.Rounds)
+	}
+
+	if wrapped.TopSubmission != nil {
+		track, err := GetTrackById(ctx, wrapped.TopSubmission.Track.Id)
+		if err != nil {
+			return MemberWrapped{}, err
+		}
+		wrapped.TopSubmission.Track = track
+	}
+
+	favorite := ""
+	for artistId, count := range artistCounts {
+		if favorite == "" || count > artistCounts[favorite] ||
+			(count == artistCounts[favorite] && (artistPoints[artistId] > artistPoints[favorite] || (artistPoints[artistId] == artistPoints[favorite] && artistId < favorite))) {
+			favorite = artistId
+		}
+	}
+	if favorite != "" {
+		wrapped.FavoriteArtist = &ArtistCount{Artist: artists[favorite], Submissions: artistCounts[favorite]}
+	}
+
+	var err error
+	if wrapped.BiggestFan, err = d.topStanding(ctx, received); err != nil {
+		return MemberWrapped{}, err
+	}
+	if wrapped.FavoriteMember, err = d.topStanding(ctx, given); err != nil {
+		return MemberWrapped{}, err
+	}
+
+	return wrapped, nil
+}
+
+// topStanding returns the member with the most points in a tally.
+func (d *wrappedData) topStanding(ctx context.Context, points map[string]int) (*Standing, error) {
+	best := ""
+	for memberId, value := range points {
+		if value > 0 && (best == "" || value > points[best] || (value == points[best] && memberId < best)) {
+			best = memberId
+		}
+	}
+
+	if best == "" {
+		return nil, nil
+	}
+
+	member, exists := d.members[best]
+	if !exists {
+		var err error
+		if member, err = GetMemberById(ctx, best); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Standing{Member: member, Points: points[best]}, nil
+}
+
+func times(n int) string {
+	switch n {
+	case 1:
+		return "once"
+	case 2:
+		return "twice"
+	default:
+		return fmt.Sprintf("%d times", n)
+	}
+}
+
+// Ordinal formats a placement as 1st, 2nd, 3rd and so on.
+func Ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+
+	return fmt.Sprintf("%d%s", n, suffix)
+}
@@ -0,0 +1,695 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a write targets a record that doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when creating a record whose id is already taken.
+var ErrConflict = errors.New("already exists")
+
+// ValidationError describes why a write was rejected.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+func invalid(format string, args ...interface{}) error {
+	return ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+type LeagueInput struct {
+	Id         string  `json:"id"`
+	Name       *string `json:"name"`
+	VoteBudget *int    `json:"vote_budget"`
+	Private    *bool   `json:"private"`
+}
+
+type MemberInput struct {
+	Id      string  `json:"id"`
+	Name    *string `json:"name"`
+	Picture *string `json:"picture"`
+}
+
+type RoundInput struct {
+	Id          string     `json:"id"`
+	Name        *string    `json:"name"`
+	Sequence    *int       `json:"sequence"`
+	Description *string    `json:"description"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// SubmissionInput names the track a member submitted. A track that isn't
+// known yet is added when TrackName is given.
+type SubmissionInput struct {
+	TrackId   string `json:"track_id"`
+	TrackName string `json:"track_name"`
+	Album     string `json:"album"`
+	Picture   string `json:"picture"`
+	Comment   string `json:"comment"`
+}
+
+type BallotVote struct {
+	RecipientId string `json:"recipient_id"`
+	Votes       int    `json:"votes"`
+	Comment     string `json:"comment"`
+}
+
+// BallotInput is every vote one member cast in a round.
+type BallotInput struct {
+	Votes []BallotVote `json:"votes"`
+}
+
+// CreateLeague adds a league and returns its id, generating one if the input
+// doesn't have one.
+func CreateLeague(ctx context.Context, input LeagueInput) (_ string, err error) {
+	ctx, span := startSpan(ctx, "CreateLeague")
+	defer endSpan(span, &err)
+
+	if input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		return "", invalid("name is required")
+	}
+	if input.VoteBudget != nil && *input.VoteBudget <= 0 {
+		return "", invalid("vote_budget must be greater than zero")
+	}
+
+	id := input.Id
+	if id == "" {
+		id = newId()
+	}
+
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		if taken, err := exists(ctx, tx, "SELECT 1 FROM leagues WHERE id = ?", id); err != nil || taken {
+			return conflict(err, "league", id)
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO leagues(id, name, vote_budget, private) VALUES (?, ?, ?, ?)",
+			id, strings.TrimSpace(*input.Name), input.VoteBudget, input.Private != nil && *input.Private)
+		return err
+	})
+
+	return id, err
+}
+
+// UpdateLeague changes the fields of a league that are set in the input.
+func UpdateLeague(ctx context.Context, leagueId string, input LeagueInput) (err error) {
+	ctx, span := startSpan(ctx, "UpdateLeague")
+	defer endSpan(span, &err)
+
+	if input.Name != nil && strings.TrimSpace(*input.Name) == "" {
+		return invalid("name can't be empty")
+	}
+	if input.VoteBudget != nil && *input.VoteBudget <= 0 {
+		return invalid("vote_budget must be greater than zero")
+	}
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM leagues WHERE id = ?", leagueId); err != nil || !found {
+			return notFound(err)
+		}
+
+		if input.Name != nil {
+			if _, err := tx.ExecContext(ctx, "UPDATE leagues SET name = ? WHERE id = ?", strings.TrimSpace(*input.Name), leagueId); err != nil {
+				return err
+			}
+		}
+		if input.VoteBudget != nil {
+			if _, err := tx.ExecContext(ctx, "UPDATE leagues SET vote_budget = ? WHERE id = ?", *input.VoteBudget, leagueId); err != nil {
+				return err
+			}
+		}
+		if input.Private != nil {
+			if _, err := tx.ExecContext(ctx, "UPDATE leagues SET private = ? WHERE id = ?", *input.Private, leagueId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteLeague removes a league along with all of its rounds, submissions
+// and votes. API keys that could only use this league are revoked.
+func DeleteLeague(ctx context.Context, leagueId string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteLeague")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM leagues WHERE id = ?", leagueId); err != nil || !found {
+			return notFound(err)
+		}
+
+		// Keys limited to only this league have nothing left to use.
+		_, err := tx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = ? WHERE revoked_at IS NULL AND NOT all_leagues
+			AND id IN (SELECT key_id FROM api_key_leagues WHERE league_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM api_key_leagues WHERE key_id = api_keys.id AND league_id <> ?)`,
+			time.Now().UTC().Truncate(time.Second), leagueId, leagueId)
+		if err != nil {
+			return err
+		}
+
+		return execAll(ctx, tx, []string{
+			"DELETE FROM results WHERE league_id = ?",
+			"DELETE FROM submissions WHERE league_id = ?",
+			"DELETE FROM comment_sentiment WHERE league_id = ?",
+			"DELETE FROM rounds WHERE league_id = ?",
+			"DELETE FROM league_members WHERE league_id = ?",
+			"DELETE FROM api_key_leagues WHERE league_id = ?",
+			"DELETE FROM leagues WHERE id = ?",
+		}, leagueId)
+	})
+}
+
+// CreateMember adds a member and returns their id, generating one if the
+// input doesn't have one.
+func CreateMember(ctx context.Context, input MemberInput) (_ string, err error) {
+	ctx, span := startSpan(ctx, "CreateMember")
+	defer endSpan(span, &err)
+
+	if input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		return "", invalid("name is required")
+	}
+
+	id := input.Id
+	if id == "" {
+		id = newId()
+	}
+
+	picture := ""
+	if input.Picture != nil {
+		picture = *input.Picture
+	}
+
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		if taken, err := exists(ctx, tx, "SELECT 1 FROM members WHERE id = ?", id); err != nil || taken {
+			return conflict(err, "member", id)
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO members(id, name, picture) VALUES (?, ?, ?)", id, strings.TrimSpace(*input.Name), picture)
+		return err
+	})
+
+	return id, err
+}
+
+// UpdateMember changes the fields of a member that are set in the input.
+func UpdateMember(ctx context.Context, memberId string, input MemberInput) (err error) {
+	ctx, span := startSpan(ctx, "UpdateMember")
+	defer endSpan(span, &err)
+
+	if input.Name != nil && strings.TrimSpace(*input.Name) == "" {
+		return invalid("name can't be empty")
+	}
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM members WHERE id = ?", memberId); err != nil || !found {
+			return notFound(err)
+		}
+
+		if input.Name != nil {
+			if _, err := tx.ExecContext(ctx, "UPDATE members SET name = ? WHERE id = ?", strings.TrimSpace(*input.Name), memberId); err != nil {
+				return err
+			}
+		}
+		if input.Picture != nil {
+			if _, err := tx.ExecContext(ctx, "UPDATE members SET picture = ? WHERE id = ?", *input.Picture, memberId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteMember removes a member who hasn't submitted or voted anywhere.
+func DeleteMember(ctx context.Context, memberId string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteMember")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM members WHERE id = ?", memberId); err != nil || !found {
+			return notFound(err)
+		}
+
+		active, err := exists(ctx, tx, `SELECT 1 FROM submissions WHERE submitter_id = ?1
+			UNION SELECT 1 FROM results WHERE voter_id = ?1 OR recipient_id = ?1`, memberId)
+		if err != nil {
+			return err
+		}
+		if active {
+			return invalid("member has submissions or votes; delete those first")
+		}
+
+		return execAll(ctx, tx, []string{
+			"DELETE FROM league_members WHERE member_id = ?",
+			"DELETE FROM members WHERE id = ?",
+		}, memberId)
+	})
+}
+
+// AddLeagueMember adds an existing member to a league.
+func AddLeagueMember(ctx context.Context, leagueId string, memberId string) (err error) {
+	ctx, span := startSpan(ctx, "AddLeagueMember")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM leagues WHERE id = ?", leagueId); err != nil || !found {
+			return notFound(err)
+		}
+		if found, err := exists(ctx, tx, "SELECT 1 FROM members WHERE id = ?", memberId); err != nil || !found {
+			return notFound(err)
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO league_members(league_id, member_id) VALUES (?, ?)", leagueId, memberId)
+		return err
+	})
+}
+
+// RemoveLeagueMember takes a member out of a league they haven't submitted
+// or voted in.
+func RemoveLeagueMember(ctx context.Context, leagueId string, memberId string) (err error) {
+	ctx, span := startSpan(ctx, "RemoveLeagueMember")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM league_members WHERE league_id = ? AND member_id = ?", leagueId, memberId); err != nil || !found {
+			return notFound(err)
+		}
+
+		active, err := exists(ctx, tx, `SELECT 1 FROM submissions WHERE league_id = ?1 AND submitter_id = ?2
+			UNION SELECT 1 FROM results WHERE league_id = ?1 AND (voter_id = ?2 OR recipient_id = ?2)`, leagueId, memberId)
+		if err != nil {
+			return err
+		}
+		if active {
+			return invalid("member has submissions or votes in this league; delete those first")
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM league_members WHERE league_id = ? AND member_id = ?", leagueId, memberId)
+		return err
+	})
+}
+
+// CreateRound adds a round to a league and returns its id. Without a
+// sequence the round goes after the league's last round.
+func CreateRound(ctx context.Context, leagueId string, input RoundInput) (_ string, err error) {
+	ctx, span := startSpan(ctx, "CreateRound")
+	defer endSpan(span, &err)
+
+	if input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		return "", invalid("name is required")
+	}
+	if input.Sequence != nil && *input.Sequence < 0 {
+		return "", invalid("sequence can't be negative")
+	}
+
+	id := input.Id
+	if id == "" {
+		id = newId()
+	}
+
+	description := ""
+	if input.Description != nil {
+		description = *input.Description
+	}
+
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM leagues WHERE id = ?", leagueId); err != nil || !found {
+			return notFound(err)
+		}
+		if taken, err := exists(ctx, tx, "SELECT 1 FROM rounds WHERE id = ?", id); err != nil || taken {
+			return conflict(err, "round", id)
+		}
+
+		var sequence int
+		if input.Sequence != nil {
+			sequence = *input.Sequence
+		} else if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(sequence) + 1, 0) FROM rounds WHERE league_id = ?", leagueId).Scan(&sequence); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO rounds(id, name, sequence, league_id, description, created_at, completed_at) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)",
+			id, strings.TrimSpace(*input.Name), sequence, leagueId, description, input.CompletedAt)
+		return err
+	})
+
+	return id, err
+}
+
+// UpdateRound changes the fields of a round that are set in the input.
+func UpdateRound(ctx context.Context, roundId string, input RoundInput) (err error) {
+	ctx, span := startSpan(ctx, "UpdateRound")
+	defer endSpan(span, &err)
+
+	if input.Name != nil && strings.TrimSpace(*input.Name) == "" {
+		return invalid("name can't be empty")
+	}
+	if input.Sequence != nil && *input.Sequence < 0 {
+		return invalid("sequence can't be negative")
+	}
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM rounds WHERE id = ?", roundId); err != nil || !found {
+			return notFound(err)
+		}
+
+		updates := []struct {
+			set   bool
+			query string
+			value interface{}
+		}{
+			{input.Name != nil, "UPDATE rounds SET name = ? WHERE id = ?", trimmed(input.Name)},
+			{input.Sequence != nil, "UPDATE rounds SET sequence = ? WHERE id = ?", input.Sequence},
+			{input.Description != nil, "UPDATE rounds SET description = ? WHERE id = ?", input.Description},
+			{input.CompletedAt != nil, "UPDATE rounds SET completed_at = ? WHERE id = ?", input.CompletedAt},
+		}
+
+		for _, update := range updates {
+			if !update.set {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, update.query, update.value, roundId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteRound removes a round along with its submissions and votes.
+func DeleteRound(ctx context.Context, roundId string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteRound")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM rounds WHERE id = ?", roundId); err != nil || !found {
+			return notFound(err)
+		}
+
+		return execAll(ctx, tx, []string{
+			"DELETE FROM results WHERE round_id = ?",
+			"DELETE FROM submissions WHERE round_id = ?",
+			"DELETE FROM comment_sentiment WHERE round_id = ?",
+			"DELETE FROM rounds WHERE id = ?",
+		}, roundId)
+	})
+}
+
+// PutSubmission sets the track a member submitted to a round, replacing any
+// earlier submission. Votes already cast for the member move to the new
+// track.
+func PutSubmission(ctx context.Context, roundId string, memberId string, input SubmissionInput) (err error) {
+	ctx, span := startSpan(ctx, "PutSubmission")
+	defer endSpan(span, &err)
+
+	if input.TrackId == "" {
+		return invalid("track_id is required")
+	}
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		leagueId, err := roundLeague(ctx, tx, roundId)
+		if err != nil {
+			return err
+		}
+		if err = requireLeagueMember(ctx, tx, leagueId, memberId); err != nil {
+			return err
+		}
+
+		known, err := exists(ctx, tx, "SELECT 1 FROM track_names WHERE id = ?", input.TrackId)
+		if err != nil {
+			return err
+		}
+		if !known {
+			if strings.TrimSpace(input.TrackName) == "" {
+				return invalid("track %s is unknown; include track_name to add it", input.TrackId)
+			}
+			if _, err = tx.ExecContext(ctx, "INSERT INTO track_names(id, name, album, picture) VALUES (?, ?, ?, ?)",
+				input.TrackId, strings.TrimSpace(input.TrackName), input.Album, input.Picture); err != nil {
+				return err
+			}
+		}
+
+		taken, err := exists(ctx, tx, "SELECT 1 FROM submissions WHERE round_id = ? AND track_id = ? AND submitter_id <> ?", roundId, input.TrackId, memberId)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return invalid("track %s was already submitted to this round by someone else", input.TrackId)
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM submissions WHERE round_id = ? AND submitter_id = ?", roundId, memberId); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "INSERT INTO submissions(league_id, round_id, submitter_id, track_id, comment) VALUES (?, ?, ?, ?, ?)",
+			leagueId, roundId, memberId, input.TrackId, input.Comment); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE results SET track_id = ? WHERE round_id = ? AND recipient_id = ?", input.TrackId, roundId, memberId)
+		return err
+	})
+}
+
+// DeleteSubmission removes a member's submission to a round and the votes it
+// received.
+func DeleteSubmission(ctx context.Context, roundId string, memberId string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteSubmission")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM submissions WHERE round_id = ? AND submitter_id = ?", roundId, memberId); err != nil || !found {
+			return notFound(err)
+		}
+
+		return execAll(ctx, tx, []string{
+			"DELETE FROM results WHERE round_id = ? AND recipient_id = ?",
+			"DELETE FROM comment_sentiment WHERE round_id = ? AND recipient_id = ?",
+			"DELETE FROM submissions WHERE round_id = ? AND submitter_id = ?",
+		}, roundId, memberId)
+	})
+}
+
+// PutBallot replaces every vote a member cast in a round. The voter must be
+// in the round's league, may only vote for submissions in the round other
+// than their own, and may not hand out more points than the league's vote
+// budget, as validateBallot checks.
+func PutBallot(ctx context.Context, roundId string, voterId string, input BallotInput) (err error) {
+	ctx, span := startSpan(ctx, "PutBallot")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		leagueId, err := roundLeague(ctx, tx, roundId)
+		if err != nil {
+			return err
+		}
+		if err = requireLeagueMember(ctx, tx, leagueId, voterId); err != nil {
+			return err
+		}
+
+		var budget sql.NullInt64
+		if err = tx.QueryRowContext(ctx, "SELECT vote_budget FROM leagues WHERE id = ?", leagueId).Scan(&budget); err != nil {
+			return err
+		}
+
+		if err = validateBallot(voterId, input, budget); err != nil {
+			return err
+		}
+
+		tracks := make(map[string]string)
+		for _, vote := range input.Votes {
+			var trackId string
+			err = tx.QueryRowContext(ctx, "SELECT track_id FROM submissions WHERE round_id = ? AND submitter_id = ? LIMIT 1", roundId, vote.RecipientId).Scan(&trackId)
+			if err == sql.ErrNoRows {
+				return invalid("%s didn't submit to this round", vote.RecipientId)
+			} else if err != nil {
+				return err
+			}
+			tracks[vote.RecipientId] = trackId
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM results WHERE round_id = ? AND voter_id = ?", roundId, voterId); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM comment_sentiment WHERE round_id = ? AND voter_id = ?", roundId, voterId); err != nil {
+			return err
+		}
+
+		// The ballot's comments are scored with it, so the sentiment stats
+		// never lag behind the votes.
+		for _, vote := range input.Votes {
+			if _, err = tx.ExecContext(ctx, "INSERT INTO results(league_id, round_id, voter_id, recipient_id, votes, track_id, comment) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				leagueId, roundId, voterId, vote.RecipientId, vote.Votes, tracks[vote.RecipientId], vote.Comment); err != nil {
+				return err
+			}
+			if vote.Comment != "" {
+				if err = scoreComment(ctx, tx, leagueId, roundId, voterId, vote.RecipientId, vote.Comment); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// validateBallot checks the votes in a ballot against each other and the
+// league's vote budget. Votes can be negative, as downvotes, or zero if they
+// carry a comment, and only the points given count against the budget.
+func validateBallot(voterId string, input BallotInput, budget sql.NullInt64) error {
+	seen := make(map[string]bool)
+	given := 0
+
+	for _, vote := range input.Votes {
+		switch {
+		case vote.RecipientId == "":
+			return invalid("recipient_id is required")
+		case vote.RecipientId == voterId:
+			return invalid("members can't vote for themselves")
+		case seen[vote.RecipientId]:
+			return invalid("more than one vote for %s", vote.RecipientId)
+		case vote.Votes == 0 && strings.TrimSpace(vote.Comment) == "":
+			return invalid("a vote for %s gives no points and has no comment", vote.RecipientId)
+		}
+		seen[vote.RecipientId] = true
+
+		if vote.Votes > 0 {
+			given += vote.Votes
+		}
+	}
+
+	if budget.Valid && int64(given) > budget.Int64 {
+		return invalid("ballot gives %d points but the vote budget is %d", given, budget.Int64)
+	}
+
+	return nil
+}
+
+// DeleteBallot removes every vote a member cast in a round.
+func DeleteBallot(ctx context.Context, roundId string, voterId string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteBallot")
+	defer endSpan(span, &err)
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if found, err := exists(ctx, tx, "SELECT 1 FROM results WHERE round_id = ? AND voter_id = ?", roundId, voterId); err != nil || !found {
+			return notFound(err)
+		}
+
+		return execAll(ctx, tx, []string{
+			"DELETE FROM results WHERE round_id = ? AND voter_id = ?",
+			"DELETE FROM comment_sentiment WHERE round_id = ? AND voter_id = ?",
+		}, roundId, voterId)
+	})
+}
+
+// withTx runs fn in a transaction, committing if it succeeds.
+func withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func exists(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (bool, error) {
+	var found int
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&found)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// execAll runs each statement with the same arguments.
+func execAll(ctx context.Context, tx *sql.Tx, statements []string, args ...interface{}) error {
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func roundLeague(ctx context.Context, tx *sql.Tx, roundId string) (string, error) {
+	var leagueId sql.NullString
+	err := tx.QueryRowContext(ctx, "SELECT league_id FROM rounds WHERE id = ?", roundId).Scan(&leagueId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if !leagueId.Valid || leagueId.String == "" {
+		return "", invalid("round %s isn't in a league", roundId)
+	}
+
+	return leagueId.String, nil
+}
+
+func requireLeagueMember(ctx context.Context, tx *sql.Tx, leagueId string, memberId string) error {
+	member, err := exists(ctx, tx, "SELECT 1 FROM league_members WHERE league_id = ? AND member_id = ?", leagueId, memberId)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return invalid("member %s isn't in league %s", memberId, leagueId)
+	}
+
+	return nil
+}
+
+// notFound turns a failed existence check into ErrNotFound, unless the check
+// itself failed.
+func notFound(err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrNotFound
+}
+
+func conflict(err error, kind string, id string) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s %s %w", kind, id, ErrConflict)
+}
+
+func trimmed(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return strings.TrimSpace(*value)
+}
+
+// newId generates a random id in the same form as the ids from Music League.
+func newId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
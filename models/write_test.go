@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestValidateBallot(t *testing.T) {
+	budget := sql.NullInt64{Int64: 10, Valid: true}
+
+	tests := []struct {
+		name   string
+		votes  []BallotVote
+		budget sql.NullInt64
+		valid  bool
+	}{
+		{"within budget", []BallotVote{{RecipientId: "b", Votes: 6}, {RecipientId: "c", Votes: 4}}, budget, true},
+		{"over budget", []BallotVote{{RecipientId: "b", Votes: 6}, {RecipientId: "c", Votes: 5}}, budget, false},
+		{"no budget", []BallotVote{{RecipientId: "b", Votes: 60}}, sql.NullInt64{}, true},
+		{"empty ballot", nil, budget, true},
+		{"downvote", []BallotVote{{RecipientId: "b", Votes: 10}, {RecipientId: "c", Votes: -2}}, budget, true},
+		{"downvotes don't free up budget", []BallotVote{{RecipientId: "b", Votes: 11}, {RecipientId: "c", Votes: -2}}, budget, false},
+		{"zero points with a comment", []BallotVote{{RecipientId: "b", Votes: 10}, {RecipientId: "c", Comment: "so close"}}, budget, true},
+		{"zero points without a comment", []BallotVote{{RecipientId: "b", Votes: 10}, {RecipientId: "c"}}, budget, false},
+		{"zero points with a blank comment", []BallotVote{{RecipientId: "c", Comment: "  "}}, budget, false},
+		{"no recipient", []BallotVote{{Votes: 1}}, budget, false},
+		{"vote for yourself", []BallotVote{{RecipientId: "a", Votes: 1}}, budget, false},
+		{"two votes for one member", []BallotVote{{RecipientId: "b", Votes: 1}, {RecipientId: "b", Votes: -1}}, budget, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateBallot("a", BallotInput{Votes: test.votes}, test.budget)
+			if test.valid && err != nil {
+				t.Errorf("validateBallot = %v, want the ballot accepted", err)
+			}
+
+			var validation ValidationError
+			if !test.valid && !errors.As(err, &validation) {
+				t.Errorf("validateBallot = %v, want a ValidationError", err)
+			}
+		})
+	}
+}
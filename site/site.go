@@ -0,0 +1,222 @@
+// Package site renders a read-only archive of every league as static HTML
+// pages, with the data behind each page alongside as JSON.
+//
+// The output only depends on the database, so rendering the same database
+// twice produces identical files and archives can be diffed between runs.
+package site
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+	"github.com/thePurpleMonkey/music-league-stats-server/views"
+)
+
+// Pages below the top level are all two directories deep, such as
+// leagues/<id>/index.html.
+const pageRoot = "../../"
+
+type generator struct {
+	dir         string
+	files       int
+	members     map[string][]views.TrackAppearance
+	tracks      map[string][]views.TrackAppearance
+	memberOrder []string
+	trackOrder  []string
+}
+
+// Render writes the archive to dir, creating it if needed, and returns the
+// number of files written. Existing files are overwritten but nothing is
+// deleted, so render into an empty directory to drop removed pages.
+func Render(ctx context.Context, dir string) (int, error) {
+	g := &generator{
+		dir:     dir,
+		members: make(map[string][]views.TrackAppearance),
+		tracks:  make(map[string][]views.TrackAppearance),
+	}
+
+	leagues, err := models.GetLeagues(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(leagues, func(i, j int) bool {
+		return leagues[i].Id < leagues[j].Id
+	})
+
+	index := views.IndexPage{Leagues: leagues}
+	if err = g.write("", "leagues", index, func(b *bytes.Buffer) error { return views.SiteIndex(b, index) }); err != nil {
+		return g.files, err
+	}
+
+	for _, league := range leagues {
+		if err = g.renderLeague(ctx, league.Id); err != nil {
+			return g.files, err
+		}
+	}
+
+	for _, memberId := range g.memberOrder {
+		if err = g.renderMember(ctx, memberId); err != nil {
+			return g.files, err
+		}
+	}
+
+	for _, trackId := range g.trackOrder {
+		if err = g.renderTrack(ctx, trackId); err != nil {
+			return g.files, err
+		}
+	}
+
+	return g.files, nil
+}
+
+func (g *generator) renderLeague(ctx context.Context, leagueId string) error {
+	wrapped, err := models.GetLeagueWrapped(ctx, leagueId)
+	if err != nil || wrapped.League.Id == "" {
+		return err
+	}
+
+	rounds, err := models.GetRounds(ctx, leagueId)
+	if err != nil {
+		return err
+	}
+
+	results, err := models.GetLeagueRoundResults(ctx, leagueId)
+	if err != nil {
+		return err
+	}
+	points := make(map[string]map[string]int)
+	for _, result := range results {
+		points[result.RoundId] = result.Points
+	}
+
+	page := views.LeaguePage{Root: pageRoot, Wrapped: wrapped, Rounds: rounds}
+	if err = g.write(filepath.Join("leagues", leagueId), "league", page, func(b *bytes.Buffer) error { return views.SiteLeague(b, page) }); err != nil {
+		return err
+	}
+
+	for _, round := range rounds {
+		if err = g.renderRound(ctx, round, points[round.Id]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) renderRound(ctx context.Context, round models.Round, points map[string]int) error {
+	submissions, err := models.GetSubmissions(ctx, round.Id)
+	if err != nil {
+		return err
+	}
+
+	page := views.RoundPage{Root: pageRoot, Round: round, Entries: make([]views.RoundEntry, 0, len(submissions))}
+
+	for _, submission := range submissions {
+		entry := views.RoundEntry{Placement: 1, Points: points[submission.Submitter.Id], Submission: submission}
+		for _, other := range points {
+			if other > entry.Points {
+				entry.Placement++
+			}
+		}
+
+		sort.SliceStable(entry.Submission.Votes, func(i, j int) bool {
+			if entry.Submission.Votes[i].Votes != entry.Submission.Votes[j].Votes {
+				return entry.Submission.Votes[i].Votes > entry.Submission.Votes[j].Votes
+			}
+			return entry.Submission.Votes[i].Voter.Id < entry.Submission.Votes[j].Voter.Id
+		})
+
+		page.Entries = append(page.Entries, entry)
+
+		appearance := views.TrackAppearance{
+			Round:     round,
+			Submitter: submission.Submitter,
+			Track:     submission.Track,
+			Points:    entry.Points,
+			Placement: entry.Placement,
+		}
+		g.addAppearance(appearance)
+
+		for _, vote := range submission.Votes {
+			g.addMember(vote.Voter.Id)
+		}
+	}
+
+	sort.SliceStable(page.Entries, func(i, j int) bool {
+		if page.Entries[i].Placement != page.Entries[j].Placement {
+			return page.Entries[i].Placement < page.Entries[j].Placement
+		}
+		return page.Entries[i].Submission.Submitter.Id < page.Entries[j].Submission.Submitter.Id
+	})
+
+	return g.write(filepath.Join("rounds", round.Id), "round", page, func(b *bytes.Buffer) error { return views.SiteRound(b, page) })
+}
+
+func (g *generator) addMember(memberId string) {
+	if _, exists := g.members[memberId]; !exists {
+		g.members[memberId] = make([]views.TrackAppearance, 0)
+		g.memberOrder = append(g.memberOrder, memberId)
+	}
+}
+
+func (g *generator) addAppearance(appearance views.TrackAppearance) {
+	g.addMember(appearance.Submitter.Id)
+	g.members[appearance.Submitter.Id] = append(g.members[appearance.Submitter.Id], appearance)
+
+	if _, exists := g.tracks[appearance.Track.Id]; !exists {
+		g.trackOrder = append(g.trackOrder, appearance.Track.Id)
+	}
+	g.tracks[appearance.Track.Id] = append(g.tracks[appearance.Track.Id], appearance)
+}
+
+func (g *generator) renderMember(ctx context.Context, memberId string) error {
+	career, err := models.GetCareer(ctx, memberId)
+	if err != nil || career.Member.Id == "" {
+		return err
+	}
+
+	page := views.MemberPage{Root: pageRoot, Career: career, Submissions: g.members[memberId]}
+	return g.write(filepath.Join("members", memberId), "member", page, func(b *bytes.Buffer) error { return views.SiteMember(b, page) })
+}
+
+func (g *generator) renderTrack(ctx context.Context, trackId string) error {
+	track, err := models.GetTrackById(ctx, trackId)
+	if err != nil || track.Id == "" {
+		return err
+	}
+
+	page := views.TrackPage{Root: pageRoot, Track: track, Appearances: g.tracks[trackId]}
+	return g.write(filepath.Join("tracks", trackId), "track", page, func(b *bytes.Buffer) error { return views.SiteTrack(b, page) })
+}
+
+// write renders a page as index.html in dir, and its data as name.json.
+func (g *generator) write(dir string, name string, data interface{}, render func(b *bytes.Buffer) error) error {
+	path := filepath.Join(g.dir, dir)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	var page bytes.Buffer
+	if err := render(&page); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(path, "index.html"), page.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(path, name+".json"), append(encoded, '\n'), 0644); err != nil {
+		return err
+	}
+
+	g.files += 2
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing settings, from the environment:
+//
+//	MLS_TRACE_EXPORTER  none, stdout or otlp (default none)
+//	MLS_TRACE_ENDPOINT  the OTLP/HTTP traces URL of an OpenTelemetry
+//	                    collector (default http://localhost:4318/v1/traces)
+//	MLS_TRACE_SAMPLE    the share of requests to trace, from 0 to 1
+//	                    (default 1). Requests that carry a traceparent
+//	                    header are traced if their caller's trace is.
+//
+// Every request has a trace ID, traced or not, which is sent back in error
+// responses and logged with the request.
+const (
+	traceExporterEnv = "MLS_TRACE_EXPORTER"
+	traceEndpointEnv = "MLS_TRACE_ENDPOINT"
+	traceSampleEnv   = "MLS_TRACE_SAMPLE"
+)
+
+const serviceName = "music-league-stats-server"
+
+// tracer starts the request and query spans. Model spans come from the
+// models' own tracer.
+var tracer = otel.Tracer("github.com/thePurpleMonkey/music-league-stats-server")
+
+// tracerProvider is set by setupTracing, and flushed by shutdownTracing.
+var tracerProvider *sdktrace.TracerProvider
+
+// setupTracing starts exporting traces, if an exporter is configured. The
+// provider is set up even if none is, so every request still gets a trace ID.
+func setupTracing() {
+	ratio, err := strconv.ParseFloat(envOrDefault(traceSampleEnv, "1"), 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		fatalf("%s must be a number from 0 to 1", traceSampleEnv)
+	}
+
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	var exporter sdktrace.SpanExporter
+
+	switch name := envOrDefault(traceExporterEnv, "none"); name {
+	case "none":
+		sampler = sdktrace.NeverSample()
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(envOrDefault(traceEndpointEnv, "http://localhost:4318/v1/traces")))
+	default:
+		fatalf("%s must be none, stdout or otlp", traceExporterEnv)
+	}
+	checkErr(err)
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sampler),
+	}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// shutdownTracing exports the spans that are still queued.
+func shutdownTracing(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+
+	return tracerProvider.Shutdown(ctx)
+}
+
+// traceRequests starts a trace for each request, or continues the caller's
+// from its traceparent header. The model functions and queries the request
+// runs are spans inside it.
+func traceRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if quietRoutes[route] {
+			c.Next()
+			return
+		}
+
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", c.Request.URL.Path)))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if errType := errorType(c); errType != "" {
+			span.SetAttributes(attribute.String("error.type", errType))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// traceQuery adds a span for each query to the model function that ran it.
+func traceQuery(ctx context.Context, query models.Query) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return
+	}
+
+	sql := strings.Fields(query.SQL)
+	if len(sql) == 0 {
+		return
+	}
+
+	_, span := tracer.Start(ctx, strings.ToUpper(sql[0]),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(query.Start),
+		trace.WithAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.statement", strings.Join(sql, " ")),
+			attribute.String("code.function", query.Func)))
+
+	// A client going away isn't the query's fault.
+	if err := query.Err; err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End(trace.WithTimestamp(query.Start.Add(query.Duration)))
+}
+
+// traceId returns the ID of the trace ctx is in, or an empty string if it
+// isn't in one.
+func traceId(ctx context.Context) string {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
+
+	return ""
+}
+
+// errorBody is the body of an error response. It carries the request's trace
+// ID so a puzzling response can be found among the traces and logs.
+func errorBody(c *gin.Context, message string) gin.H {
+	return gin.H{"error": message, "trace_id": traceId(c.Request.Context())}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceRequests(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(traceRequests())
+	router.GET("/v1/leagues/:league_id", func(c *gin.Context) {
+		c.IndentedJSON(http.StatusInternalServerError, errorBody(c, "the query failed"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/leagues/a", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var body struct {
+		TraceId string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("the error has trace ID %q, want the caller's", body.TraceId)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /v1/leagues/:league_id" {
+		t.Errorf("the span is named %q", span.Name())
+	}
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("the span's parent is %s, want the caller's span", span.Parent().SpanID())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("the span's status is %v, want an error", span.Status())
+	}
+}
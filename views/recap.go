@@ -0,0 +1,54 @@
+package views
+
+import (
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// RecapFormats are the formats a round recap can be written in.
+var RecapFormats = []string{"markdown", "text"}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "#", `\#`, "<", `\<`, ">", `\>`, "|", `\|`,
+)
+
+var recapTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"ordinal": models.Ordinal,
+	"md":      markdownEscaper.Replace,
+	"oneline": func(text string) string {
+		return strings.Join(strings.Fields(text), " ")
+	},
+	"medal": func(placement int) string {
+		switch placement {
+		case 1:
+			return "🥇"
+		case 2:
+			return "🥈"
+		case 3:
+			return "🥉"
+		default:
+			return models.Ordinal(placement)
+		}
+	},
+	"artists": func(track models.Track) string {
+		names := make([]string, len(track.Artists))
+		for i, artist := range track.Artists {
+			names[i] = artist.Name
+		}
+		return strings.Join(names, ", ")
+	},
+}).ParseFS(files, "templates/*.tmpl"))
+
+// RoundRecap writes a round recap as markdown or plain text, for pasting into
+// a group chat.
+func RoundRecap(w io.Writer, recap models.RoundRecap, format string) error {
+	name := "recap.md.tmpl"
+	if format == "text" {
+		name = "recap.txt.tmpl"
+	}
+
+	return recapTemplates.ExecuteTemplate(w, name, recap)
+}
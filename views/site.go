@@ -0,0 +1,74 @@
+package views
+
+import (
+	"io"
+
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// Pages of the static league archive. Links between pages are relative to
+// Root, the path from the page back to the top of the site, so the archive
+// can be hosted under any path or opened straight from disk.
+
+type IndexPage struct {
+	Root    string          `json:"-"`
+	Leagues []models.League `json:"leagues"`
+}
+
+type LeaguePage struct {
+	Root    string               `json:"-"`
+	Wrapped models.LeagueWrapped `json:"wrapped"`
+	Rounds  []models.Round       `json:"rounds"`
+}
+
+type RoundEntry struct {
+	Placement  int               `json:"placement"`
+	Points     int               `json:"points"`
+	Submission models.Submission `json:"submission"`
+}
+
+type RoundPage struct {
+	Root    string       `json:"-"`
+	Round   models.Round `json:"round"`
+	Entries []RoundEntry `json:"entries"`
+}
+
+type TrackAppearance struct {
+	Round     models.Round  `json:"round"`
+	Submitter models.Member `json:"submitter"`
+	Track     models.Track  `json:"track"`
+	Points    int           `json:"points"`
+	Placement int           `json:"placement"`
+}
+
+type MemberPage struct {
+	Root        string            `json:"-"`
+	Career      models.Career     `json:"career"`
+	Submissions []TrackAppearance `json:"submissions"`
+}
+
+type TrackPage struct {
+	Root        string            `json:"-"`
+	Track       models.Track      `json:"track"`
+	Appearances []TrackAppearance `json:"appearances"`
+}
+
+func SiteIndex(w io.Writer, page IndexPage) error {
+	return templates.ExecuteTemplate(w, "site_index.html", page)
+}
+
+func SiteLeague(w io.Writer, page LeaguePage) error {
+	return templates.ExecuteTemplate(w, "site_league.html", page)
+}
+
+func SiteRound(w io.Writer, page RoundPage) error {
+	return templates.ExecuteTemplate(w, "site_round.html", page)
+}
+
+func SiteMember(w io.Writer, page MemberPage) error {
+	return templates.ExecuteTemplate(w, "site_member.html", page)
+}
+
+func SiteTrack(w io.Writer, page TrackPage) error {
+	return templates.ExecuteTemplate(w, "site_track.html", page)
+}
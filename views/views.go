@@ -0,0 +1,38 @@
+// Package views renders stats as self-contained HTML pages, with styles
+// inlined so a page can be saved or shared as a single file.
+package views
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+//go:embed templates/*.html templates/*.tmpl
+var files embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"ordinal": models.Ordinal,
+	"inc": func(i int) int {
+		return i + 1
+	},
+	"percent": func(value float64) string {
+		return fmt.Sprintf("%.0f%%", value*100)
+	},
+	"decimal": func(value float64) string {
+		return fmt.Sprintf("%.1f", value)
+	},
+}).ParseFS(files, "templates/*.html"))
+
+// LeagueWrapped renders a league's year-in-review page.
+func LeagueWrapped(w io.Writer, wrapped models.LeagueWrapped) error {
+	return templates.ExecuteTemplate(w, "league_wrapped.html", wrapped)
+}
+
+// MemberWrapped renders a member's year-in-review page.
+func MemberWrapped(w io.Writer, wrapped models.MemberWrapped) error {
+	return templates.ExecuteTemplate(w, "member_wrapped.html", wrapped)
+}
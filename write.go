@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thePurpleMonkey/music-league-stats-server/models"
+)
+
+// MLS_ADMIN_TOKEN sets a shared token that can be used as an API key with
+// the admin scope, for setting things up before any keys have been created.
+const adminTokenEnv = "MLS_ADMIN_TOKEN"
+
+// Callers can name themselves in this header, which is useful with the
+// shared admin token. The name is recorded in the audit log next to the key
+// or token used, but isn't trusted.
+const actorHeader = "X-Actor"
+
+func adminToken() string {
+	return os.Getenv(adminTokenEnv)
+}
+
+// addWriteRoutes adds the endpoints that change data. They need an API key
+// with the write scope, and one that can use the league being changed.
+// Leagues and members are shared between leagues, so creating them, or
+// changing a member, needs a key that can use every league.
+func addWriteRoutes(group *gin.RouterGroup) {
+	write := group.Group("", requireScope(models.ScopeWrite))
+
+	everyLeague := write.Group("", requireAllLeagues())
+	{
+		everyLeague.POST("leagues", createLeague)
+		everyLeague.POST("members", createMember)
+		everyLeague.PATCH("members/:member_id", updateMember)
+		everyLeague.DELETE("members/:member_id", deleteMember)
+	}
+
+	league := write.Group("", requireLeague())
+	{
+		league.PATCH("leagues/:league_id", updateLeague)
+		league.DELETE("leagues/:league_id", deleteLeague)
+		league.PUT("leagues/:league_id/members/:member_id", addLeagueMember)
+		league.DELETE("leagues/:league_id/members/:member_id", removeLeagueMember)
+		league.POST("leagues/:league_id/rounds", createRound)
+
+		league.PATCH("rounds/:round_id", updateRound)
+		league.DELETE("rounds/:round_id", deleteRound)
+		league.PUT("rounds/:round_id/submissions/:member_id", putSubmission)
+		league.DELETE("rounds/:round_id/submissions/:member_id", deleteSubmission)
+		league.PUT("rounds/:round_id/votes/:member_id", putBallot)
+		league.DELETE("rounds/:round_id/votes/:member_id", deleteBallot)
+	}
+}
+
+// actor names who made an authenticated request.
+func actor(c *gin.Context) models.Actor {
+	return models.Actor{Name: c.GetString("actor"), ReportedName: c.GetHeader(actorHeader)}
+}
+
+func createLeague(c *gin.Context) {
+	var input models.LeagueInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	leagueId, err := models.CreateLeague(c.Request.Context(), input)
+	if writeFailed(c, err) {
+		return
+	}
+
+	league, err := models.GetLeagueById(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, league)
+}
+
+func updateLeague(c *gin.Context) {
+	var input models.LeagueInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	leagueId := c.Param("league_id")
+	if writeFailed(c, models.UpdateLeague(c.Request.Context(), leagueId, input)) {
+		return
+	}
+
+	league, err := models.GetLeagueById(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, league)
+}
+
+func deleteLeague(c *gin.Context) {
+	if writeFailed(c, models.DeleteLeague(c.Request.Context(), c.Param("league_id"))) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func addLeagueMember(c *gin.Context) {
+	leagueId := c.Param("league_id")
+	if writeFailed(c, models.AddLeagueMember(c.Request.Context(), leagueId, c.Param("member_id"))) {
+		return
+	}
+
+	members, err := models.GetMembers(c.Request.Context(), leagueId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, members)
+}
+
+func removeLeagueMember(c *gin.Context) {
+	if writeFailed(c, models.RemoveLeagueMember(c.Request.Context(), c.Param("league_id"), c.Param("member_id"))) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func createRound(c *gin.Context) {
+	var input models.RoundInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	roundId, err := models.CreateRound(c.Request.Context(), c.Param("league_id"), input)
+	if writeFailed(c, err) {
+		return
+	}
+
+	round, err := models.GetRoundById(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, round)
+}
+
+func updateRound(c *gin.Context) {
+	var input models.RoundInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	roundId := c.Param("round_id")
+	if writeFailed(c, models.UpdateRound(c.Request.Context(), roundId, input)) {
+		return
+	}
+
+	round, err := models.GetRoundById(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, round)
+}
+
+func deleteRound(c *gin.Context) {
+	if writeFailed(c, models.DeleteRound(c.Request.Context(), c.Param("round_id"))) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func createMember(c *gin.Context) {
+	var input models.MemberInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	memberId, err := models.CreateMember(c.Request.Context(), input)
+	if writeFailed(c, err) {
+		return
+	}
+
+	member, err := models.GetMemberById(c.Request.Context(), memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, member)
+}
+
+func updateMember(c *gin.Context) {
+	var input models.MemberInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	memberId := c.Param("member_id")
+	if writeFailed(c, models.UpdateMember(c.Request.Context(), memberId, input)) {
+		return
+	}
+
+	member, err := models.GetMemberById(c.Request.Context(), memberId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, member)
+}
+
+func deleteMember(c *gin.Context) {
+	if writeFailed(c, models.DeleteMember(c.Request.Context(), c.Param("member_id"))) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func putSubmission(c *gin.Context) {
+	var input models.SubmissionInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	roundId := c.Param("round_id")
+	memberId := c.Param("member_id")
+	if writeFailed(c, models.PutSubmission(c.Request.Context(), roundId, memberId, input)) {
+		return
+	}
+
+	submissions, err := models.GetSubmissions(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	for _, submission := range submissions {
+		if submission.Submitter.Id == memberId {
+			c.IndentedJSON(http.StatusOK, submission)
+			return
+		}
+	}
+}
+
+func deleteSubmission(c *gin.Context) {
+	if writeFailed(c, models.DeleteSubmission(c.Request.Context(), c.Param("round_id"), c.Param("member_id"))) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func putBallot(c *gin.Context) {
+	var input models.BallotInput
+	if !bindInput(c, &input) {
+		return
+	}
+
+	roundId := c.Param("round_id")
+	memberId := c.Param("member_id")
+	if writeFailed(c, models.PutBallot(c.Request.Context(), roundId, memberId, input)) {
+		return
+	}
+
+	ballots, err := models.GetVotesByVoter(c.Request.Context(), roundId)
+	if queryFailed(c, err) {
+		return
+	}
+
+	for _, ballot := range ballots {
+		if ballot.Voter.Id == memberId {
+			c.IndentedJSON(http.StatusOK, ballot)
+			return
+		}
+	}
+
+	// An empty ballot leaves no votes to return.
+	c.Status(http.StatusNoContent)
+}
+
+func deleteBallot(c *gin.Context) {
+	if writeFailed(c, models.DeleteBallot(c.Request.Context(), c.Param("round_id"), c.Param("member_id"))) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// bindInput decodes the JSON request body, responding with an error if it
+// isn't valid.
+func bindInput(c *gin.Context, input interface{}) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.IndentedJSON(http.StatusRequestEntityTooLarge, errorBody(c, err.Error()))
+		} else {
+			c.IndentedJSON(http.StatusBadRequest, errorBody(c, err.Error()))
+		}
+		return false
+	}
+
+	return true
+}
+
+// writeFailed responds to a write that was rejected and reports whether it
+// did. Other errors are handled as in queryFailed.
+func writeFailed(c *gin.Context, err error) bool {
+	var validation models.ValidationError
+
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, models.ErrNotFound):
+		c.IndentedJSON(http.StatusNotFound, errorBody(c, "No Records Found"))
+	case errors.Is(err, models.ErrConflict):
+		c.IndentedJSON(http.StatusConflict, errorBody(c, err.Error()))
+	case errors.As(err, &validation):
+		c.IndentedJSON(http.StatusBadRequest, errorBody(c, validation.Message))
+	default:
+		return queryFailed(c, err)
+	}
+
+	return true
+}